@@ -5,10 +5,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/trynoice/iris/internal/config"
+	"github.com/trynoice/iris/internal/email"
 )
 
 var defaultConfig = &config.Config{
@@ -16,8 +18,12 @@ var defaultConfig = &config.Config{
 		AwsSes: &config.AwsSesServiceConfig{
 			UseSharedConfig: true,
 		},
-		RateLimit: 10,
-		Retries:   3,
+		RateLimit:      10,
+		Retries:        3,
+		RetryBaseDelay: time.Second,
+		RetryMaxDelay:  30 * time.Second,
+		RetryJitter:    0.5,
+		Concurrency:    1,
 	},
 	Message: config.MessageConfig{
 		Sender:                   "Iris CLI <iris@example.test>",
@@ -26,6 +32,7 @@ var defaultConfig = &config.Config{
 		RecipientDataCsvFile:     "recipients.csv",
 		RecipientEmailColumnName: "Email",
 		MinifyHtml:               true,
+		MissingKeyPolicy:         "error",
 	},
 }
 
@@ -51,11 +58,42 @@ You can inject data into templates, e.g. a date - {{.Date}} or your email - {{.E
   </body>
 </html>`,
 
+	"body.md": `# Hello {{.Name}}
+
+Iris is a CLI tool for sending templated bulk emails.
+
+You can inject data into templates, e.g. a date - {{.Date}} or your email - {{.Email}}.`,
+
 	"default.csv":    "Date\nJanuary 2006",
 	"recipients.csv": "Name,Email\nJack,jack@example.test\nJill,jill@example.test",
 }
 
+const (
+	formatHtml     = "html"
+	formatMarkdown = "markdown"
+)
+
+// bodyFormats maps the email body files to the format that generates them.
+var bodyFormats = map[string]string{
+	"body.txt":  formatHtml,
+	"body.html": formatHtml,
+	"body.md":   formatMarkdown,
+}
+
+// layoutHtmlBody extends the shared layout in the partials directory.
+const layoutHtmlBody = `{{ template "layout.html" . }}
+
+{{ define "content" }}
+<p>Iris is a CLI tool for sending templated bulk emails.</p>
+<p>
+  You can inject data into templates, e.g. a date - {{.Date}} or your
+  email - {{.Email}}.
+</p>
+{{ end }}`
+
 func InitCommand(v *viper.Viper, configFileName string) *cobra.Command {
+	partialsDir := ""
+	format := formatHtml
 	c := &cobra.Command{
 		Use:   "init [dir]",
 		Short: "Create working files in the given directory",
@@ -66,6 +104,10 @@ func InitCommand(v *viper.Viper, configFileName string) *cobra.Command {
 				wd = args[0]
 			}
 
+			if format != formatHtml && format != formatMarkdown {
+				return fmt.Errorf("invalid format %q: must be %q or %q", format, formatHtml, formatMarkdown)
+			}
+
 			v.AddConfigPath(wd)
 			cfg, err := config.Read(v)
 			if err != nil {
@@ -80,17 +122,45 @@ func InitCommand(v *viper.Viper, configFileName string) *cobra.Command {
 			}
 
 			cfgFile := filepath.Join(wd, configFileName)
-			if notExists(cfgFile) {
+			hasCfgFile := !notExists(cfgFile)
+			if !hasCfgFile {
 				// consider this default configuration for generating all files
 				// if user didn't supply a config.
-				cfg = defaultConfig
+				defaults := *defaultConfig
+				defaults.Message.PartialsDir = partialsDir
+				cfg = &defaults
+			} else if partialsDir != "" && partialsDir != cfg.Message.PartialsDir {
+				return fmt.Errorf("partials directory doesn't match message.partialsDir in %s", cfgFile)
+			}
+
+			// the markdown body uses the layout only if it exists.
+			if cfg.Message.PartialsDir != "" && format == formatHtml {
+				dir := cfg.Message.PartialsDir
+				if !filepath.IsAbs(dir) {
+					dir = filepath.Join(wd, dir)
+				}
+
+				if notExists(filepath.Join(dir, email.LayoutFile)) {
+					return fmt.Errorf("%s not found in the partials directory", email.LayoutFile)
+				}
+			}
+
+			if !hasCfgFile {
 				cmd.Println("creating file", cfgFile)
-				if err := config.Write(defaultConfig, cfgFile); err != nil {
+				if err := config.Write(cfg, cfgFile); err != nil {
 					return fmt.Errorf("failed to write default config: %w", err)
 				}
 			}
 
 			for name, content := range defaultEmailFiles {
+				if f, ok := bodyFormats[name]; ok && f != format {
+					continue
+				}
+
+				if name == "body.html" && cfg.Message.PartialsDir != "" {
+					content = layoutHtmlBody
+				}
+
 				switch name {
 				case "default.csv":
 					name = cfg.Message.DefaultDataCsvFile
@@ -121,6 +191,8 @@ func InitCommand(v *viper.Viper, configFileName string) *cobra.Command {
 		},
 	}
 
+	c.Flags().StringVar(&partialsDir, "partials-dir", partialsDir, "generate body.html from the layout.html in the given partials directory")
+	c.Flags().StringVar(&format, "format", format, "format of the generated email body: 'html' or 'markdown'")
 	return c
 }
 
@@ -114,6 +114,70 @@ message:
 		assert.Contains(t, string(dataCsvData), "Recipient")
 	})
 
+	t.Run("WithPartialsDir", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(tmpDir, "shared"), os.ModePerm))
+		testutil.CreateFile(t, filepath.Join(tmpDir, "shared"), "layout.html", `<main>{{ block "content" . }}{{ end }}</main>`)
+
+		wd := filepath.Join(tmpDir, "campaign")
+		c := cmd.InitCommand(viper.New(), cfgFileName)
+		c.SetOut(&bytes.Buffer{})
+		c.SetErr(&bytes.Buffer{})
+		c.SetArgs([]string{wd, "--partials-dir", "../shared"})
+		err := c.Execute()
+		assert.NoError(t, err)
+
+		cfgData, err := os.ReadFile(filepath.Join(wd, cfgFileName))
+		assert.NoError(t, err)
+		assert.Contains(t, string(cfgData), "partialsDir: ../shared")
+
+		bodyHtmlData, err := os.ReadFile(filepath.Join(wd, "body.html"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(bodyHtmlData), `{{ template "layout.html" . }}`)
+		assert.Contains(t, string(bodyHtmlData), `{{ define "content" }}`)
+	})
+
+	t.Run("WithMarkdownFormat", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		c := cmd.InitCommand(viper.New(), cfgFileName)
+		c.SetOut(&bytes.Buffer{})
+		c.SetErr(&bytes.Buffer{})
+		c.SetArgs([]string{tmpDir, "--format", "markdown"})
+		err := c.Execute()
+		assert.NoError(t, err)
+
+		files, err := os.ReadDir(tmpDir)
+		require.NoError(t, err)
+
+		names := []string{}
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+
+		assert.ElementsMatch(t, []string{"subject.txt", "body.md", "default.csv", "recipients.csv", cfgFileName}, names)
+	})
+
+	t.Run("WithInvalidFormat", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		c := cmd.InitCommand(viper.New(), cfgFileName)
+		c.SetOut(&bytes.Buffer{})
+		c.SetErr(&bytes.Buffer{})
+		c.SetArgs([]string{tmpDir, "--format", "pdf"})
+		err := c.Execute()
+		assert.Error(t, err)
+	})
+
+	t.Run("WithPartialsDirWithoutLayout", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		c := cmd.InitCommand(viper.New(), cfgFileName)
+		c.SetOut(&bytes.Buffer{})
+		c.SetErr(&bytes.Buffer{})
+		c.SetArgs([]string{tmpDir, "--partials-dir", "shared"})
+		err := c.Execute()
+		assert.Error(t, err)
+		assert.NoFileExists(t, filepath.Join(tmpDir, cfgFileName))
+	})
+
 	for file, content := range map[string]string{
 		"subject.txt":    "test-subject",
 		"body.txt":       "test-text-body",
@@ -2,9 +2,13 @@ package cmd
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -14,6 +18,16 @@ import (
 
 func SendCommand(v *viper.Viper) *cobra.Command {
 	isDryRun := false
+	resume := false
+	resetJournal := false
+	workers := 1
+	onError := onErrorAbort
+	reportFile := ""
+	dataFile := ""
+	yes := false
+	filter := ""
+	limit := 0
+	offset := 0
 	c := &cobra.Command{
 		Use:   "send [dir]",
 		Short: "Send emails using the working files in the current directory",
@@ -30,35 +44,156 @@ func SendCommand(v *viper.Viper) *cobra.Command {
 				return err
 			}
 
-			t, err := email.NewTemplate(wd, cfg.Message.MinifyHtml)
+			if cmd.Flags().Changed("data") {
+				cfg.Message.RecipientDataCsvFile = dataFile
+				cfg.Message.RecipientSource = nil
+			}
+
+			t, err := email.NewTemplate(wd, &cfg.Message)
 			if err != nil {
 				return err
 			}
 
-			r, err := email.NewDataReader(wd, cfg.Message.DefaultDataCsvFile, cfg.Message.RecipientDataCsvFile)
+			r, err := email.NewDataReader(wd, &cfg.Message, cmd.InOrStdin())
 			if err != nil {
 				return err
 			}
 
 			defer r.Close()
+			if resume && resetJournal {
+				return fmt.Errorf("cannot use --resume with --reset-journal")
+			}
+
+			if onError != onErrorAbort && onError != onErrorSkip {
+				return fmt.Errorf("unrecognised on-error mode: %s", onError)
+			}
+
+			if !cmd.Flags().Changed("workers") {
+				workers = cfg.Service.Concurrency
+			}
+
+			if workers < 1 {
+				return fmt.Errorf("number of workers must be at least 1")
+			}
+
+			if limit < 0 || offset < 0 {
+				return fmt.Errorf("limit and offset must not be negative")
+			}
+
+			if !cmd.Flags().Changed("filter") {
+				filter = cfg.Message.Filter
+			}
+
+			var rowFilter *email.Filter
+			if filter != "" {
+				if rowFilter, err = email.NewFilter(filter); err != nil {
+					return err
+				}
+			}
+
+			suppressions, err := loadSuppressionList(wd, cfg)
+			if err != nil {
+				return err
+			}
+
+			attachments := make([]*email.Attachment, 0, len(cfg.Message.Attachments))
+			for _, p := range cfg.Message.Attachments {
+				a, err := email.LoadAttachment(wd, p)
+				if err != nil {
+					return err
+				}
+
+				attachments = append(attachments, a)
+			}
+
+			sizeChecker, err := newAttachmentSizeChecker(wd, cfg, attachments)
+			if err != nil {
+				return err
+			}
+
+			// stdin can only be read once, so its rows are checked while sending.
+			if !readsStdin(cfg) {
+				if err := checkAttachmentSizes(wd, cfg, sizeChecker); err != nil {
+					return err
+				}
+			}
+
 			opts := []email.ServiceOption{
 				email.WithRateLimit(cfg.Service.RateLimit),
-				email.WithRetries(cfg.Service.Retries),
+				email.WithRetries(email.RetryPolicy{
+					Retries:   cfg.Service.Retries,
+					BaseDelay: cfg.Service.RetryBaseDelay,
+					MaxDelay:  cfg.Service.RetryMaxDelay,
+					Jitter:    cfg.Service.RetryJitter,
+				}),
 			}
 
-			if !isDryRun && !askConfirmation("confirm sending emails?", cmd.InOrStdin(), cmd.OutOrStdout()) {
-				return nil
+			// dry runs don't deliver anything, so there is nothing to journal.
+			var journal *email.Journal
+			openJournal := func() error {
+				if journal, err = email.OpenJournal(wd, resume); errors.Is(err, email.ErrJournalExists) {
+					return fmt.Errorf("%w, use --resume to skip the recipients it delivered to or --reset-journal to discard it", err)
+				}
+
+				return err
+			}
+
+			// check the journal before asking for confirmation, but only discard
+			// it once the sending is confirmed.
+			if !isDryRun && !resetJournal {
+				if err := openJournal(); err != nil {
+					return err
+				}
+
+				defer journal.Close()
 			}
 
+			if !isDryRun && !yes {
+				in := cmd.InOrStdin()
+				if readsStdin(cfg) {
+					// the recipient data has taken the standard input.
+					tty, err := os.Open("/dev/tty")
+					if err != nil {
+						return fmt.Errorf("failed to open terminal for confirmation, use --yes to skip it: %w", err)
+					}
+
+					defer tty.Close()
+					in = tty
+				}
+
+				if !askConfirmation("confirm sending emails?", in, cmd.OutOrStdout()) {
+					return nil
+				}
+			}
+
+			if !isDryRun && resetJournal {
+				if err := email.ResetJournal(wd); err != nil {
+					return err
+				}
+
+				if err := openJournal(); err != nil {
+					return err
+				}
+
+				defer journal.Close()
+			}
+
+			// workers write to the output concurrently.
+			out := &lockedWriter{mutex: sync.Mutex{}, w: cmd.OutOrStdout()}
 			var svc email.Service
 			if isDryRun {
-				svc = email.NewPrintService(cmd.OutOrStdout(), opts...)
+				svc = email.NewPrintService(out, opts...)
 			} else if cfg.Service.AwsSes != nil {
 				if svc, err = email.NewAwsSesService(cfg.Service.AwsSes, opts...); err != nil {
 					return fmt.Errorf("failed to initialise aws ses service: %w", err)
 				}
 			} else if cfg.Service.Smtp != nil {
-				if svc, err = email.NewSmtpService(cfg.Service.Smtp, opts...); err != nil {
+				if dkim := cfg.Service.Smtp.Dkim; dkim != nil && !filepath.IsAbs(dkim.PrivateKeyFile) {
+					// the key file is relative to the working directory.
+					dkim.PrivateKeyFile = filepath.Join(wd, dkim.PrivateKeyFile)
+				}
+
+				if svc, err = email.NewSmtpService(cfg.Service.Smtp, workers, opts...); err != nil {
 					return fmt.Errorf("failed to initialise smtp service: %w", err)
 				}
 			} else {
@@ -67,36 +202,448 @@ func SendCommand(v *viper.Viper) *cobra.Command {
 
 			defer svc.Close()
 
-			for {
-				recipientData, err := r.Read()
-				if err == io.EOF {
-					break
-				} else if err != nil {
+			var report *email.ReportWriter
+			if reportFile != "" {
+				if report, err = email.NewReportWriter(reportFile); err != nil {
 					return err
 				}
 
-				msg, err := t.Render(recipientData)
-				if err != nil {
-					return err
+				defer report.Close()
+			}
+
+			summary := newSendSummary(isDryRun)
+			record := func(entry *email.ReportEntry) error {
+				summary.add(entry.Status)
+				if journal != nil && entry.Status != email.StatusSkipped && entry.Status != email.StatusSuppressed {
+					if err := journal.Record(&email.JournalEntry{
+						Row:       entry.Row,
+						Address:   entry.Address,
+						Status:    entry.Status,
+						MessageId: entry.MessageId,
+						Error:     entry.Error,
+					}); err != nil {
+						return err
+					}
+				}
+
+				if report != nil {
+					return report.Write(entry)
+				}
+
+				return nil
+			}
+
+			// the rows are selected in order, so that the offset and limit apply
+			// to the same rows across runs.
+			selected := 0
+			accept := func(row int, recipientData any) (bool, error) {
+				if rowFilter != nil {
+					to := strings.Join(recipientList(recipientData, cfg.Message.RecipientEmailColumnName, cfg.Message.RecipientListDelimiter), ", ")
+					matches, matchErr := rowFilter.Match(recipientData)
+					if matchErr != nil {
+						entry := &email.ReportEntry{Row: row, Address: to, Status: email.StatusFailed, Error: matchErr.Error()}
+						if err := record(entry); err != nil {
+							return false, err
+						}
+
+						if onError == onErrorAbort {
+							return false, fmt.Errorf("row %d: %w", row, matchErr)
+						}
+
+						fmt.Fprintf(out, "skipping row %d: %v\n", row, matchErr)
+						return false, nil
+					}
+
+					if !matches {
+						return false, record(&email.ReportEntry{Row: row, Address: to, Status: email.StatusSkipped})
+					}
 				}
 
-				if err := svc.Send(&email.SendOptions{
+				if selected++; selected <= offset {
+					return false, nil
+				} else if limit > 0 && selected > offset+limit {
+					return false, io.EOF
+				}
+
+				return true, nil
+			}
+
+			err = dispatch(r, workers, accept, func(row int, recipientData any) error {
+				sendOpts := &email.SendOptions{
 					From:    cfg.Message.Sender,
-					To:      recipientData[cfg.Message.RecipientEmailColumnName],
 					ReplyTo: cfg.Message.ReplyToAddresses,
-					Message: msg,
-				}); err != nil {
+					To:      recipientList(recipientData, cfg.Message.RecipientEmailColumnName, cfg.Message.RecipientListDelimiter),
+					Cc:      recipientList(recipientData, cfg.Message.RecipientCcColumnName, cfg.Message.RecipientListDelimiter),
+					Bcc:     recipientList(recipientData, cfg.Message.RecipientBccColumnName, cfg.Message.RecipientListDelimiter),
+				}
+
+				to := strings.Join(sendOpts.To, ", ")
+				if journal != nil && journal.IsDelivered(row, to) {
+					fmt.Fprintf(out, "skipping row %d: already delivered to %s\n", row, to)
+					return record(&email.ReportEntry{Row: row, Address: to, Status: email.StatusSkipped})
+				}
+
+				sendOpts.To = removeSuppressed(suppressions, sendOpts.To)
+				sendOpts.Cc = removeSuppressed(suppressions, sendOpts.Cc)
+				sendOpts.Bcc = removeSuppressed(suppressions, sendOpts.Bcc)
+				if len(sendOpts.To) == 0 && to != "" {
+					fmt.Fprintf(out, "skipping row %d: %s is suppressed\n", row, to)
+					return record(&email.ReportEntry{Row: row, Address: to, Status: email.StatusSuppressed})
+				}
+
+				entry := &email.ReportEntry{Row: row, Address: to, Status: email.StatusSent}
+				if isDryRun {
+					entry.Status = email.StatusDryRun
+				}
+				result, sendErr := func() (*email.SendResult, error) {
+					msg, err := t.Render(recipientData)
+					if err != nil {
+						return nil, err
+					}
+
+					entry.Variant = msg.Variant
+					if readsStdin(cfg) {
+						if err := sizeChecker.check(recipientData); err != nil {
+							return nil, err
+						}
+					}
+
+					sendOpts.Message = msg
+					sendOpts.Attachments = attachments
+					for _, p := range recipientList(recipientData, cfg.Message.RecipientAttachmentsColumnName, cfg.Message.RecipientListDelimiter) {
+						a, err := email.LoadAttachment(wd, p)
+						if err != nil {
+							return nil, err
+						}
+
+						sendOpts.Attachments = append(sendOpts.Attachments, a)
+					}
+
+					return svc.Send(sendOpts)
+				}()
+
+				if result != nil {
+					entry.MessageId = result.MessageId
+					entry.Attempts = result.Attempts
+				}
+
+				if sendErr != nil {
+					entry.Status = email.StatusFailed
+					entry.Error = sendErr.Error()
+				}
+
+				if err := record(entry); err != nil {
 					return err
 				}
+
+				if sendErr != nil {
+					if onError == onErrorAbort {
+						return fmt.Errorf("row %d: %w", row, sendErr)
+					}
+
+					fmt.Fprintf(out, "skipping row %d: %v\n", row, sendErr)
+				}
+
+				return nil
+			})
+
+			fmt.Fprintln(out, summary)
+			if err != nil {
+				return err
 			}
+
+			if n := summary.count(email.StatusFailed); n > 0 {
+				return fmt.Errorf("failed to send %d email(s)", n)
+			}
+
 			return nil
 		},
 	}
 
 	c.Flags().BoolVarP(&isDryRun, "dry-run", "d", isDryRun, "print rendered emails without sending them")
+	c.Flags().BoolVar(&resume, "resume", resume, "skip recipients that were delivered in a previous run")
+	c.Flags().BoolVar(&resetJournal, "reset-journal", resetJournal, "discard the journal of a previous run before sending emails")
+	c.Flags().IntVarP(&workers, "workers", "w", workers, "number of emails to render and send in parallel (default service.concurrency)")
+	c.Flags().StringVar(&onError, "on-error", onError, "what to do when an email fails to render or send: 'abort' or 'skip'")
+	c.Flags().StringVar(&reportFile, "report", reportFile, "write the outcome of each recipient to a csv or jsonl file")
+	c.Flags().StringVar(&dataFile, "data", dataFile, "read the recipient data from the given file, or from stdin if it is '-'")
+	c.Flags().BoolVarP(&yes, "yes", "y", yes, "send emails without asking for confirmation")
+	c.Flags().StringVar(&filter, "filter", filter, "send emails only to the recipients matching the given expression (default message.filter)")
+	c.Flags().IntVar(&limit, "limit", limit, "send emails to at most the given number of recipients")
+	c.Flags().IntVar(&offset, "offset", offset, "skip the given number of recipients before sending emails")
 	return c
 }
 
+// readsStdin reports whether the recipient data is read from the standard
+// input.
+func readsStdin(cfg *config.Config) bool {
+	return cfg.Message.RecipientSource == nil && cfg.Message.RecipientDataCsvFile == email.StdinDataFile
+}
+
+func newAttachmentSizeChecker(wd string, cfg *config.Config, attachments []*email.Attachment) (*attachmentSizeChecker, error) {
+	limit := int64(email.DefaultSmtpMaxMessageSize)
+	if cfg.Service.AwsSes != nil {
+		limit = email.AwsSesMaxMessageSize
+	} else if cfg.Service.Smtp != nil && cfg.Service.Smtp.MaxMessageSize > 0 {
+		limit = int64(cfg.Service.Smtp.MaxMessageSize)
+	}
+
+	staticSize := int64(0)
+	for _, a := range attachments {
+		staticSize += email.EncodedAttachmentSize(int64(len(a.Data)))
+	}
+
+	if staticSize > limit {
+		return nil, fmt.Errorf("attachments exceed the message size limit of %d bytes", limit)
+	}
+
+	return &attachmentSizeChecker{
+		wd:         wd,
+		column:     cfg.Message.RecipientAttachmentsColumnName,
+		delimiter:  cfg.Message.RecipientListDelimiter,
+		limit:      limit,
+		staticSize: staticSize,
+	}, nil
+}
+
+// attachmentSizeChecker ensures that the attachments of a recipient exist and
+// fit within the message size limit of the configured service.
+type attachmentSizeChecker struct {
+	wd         string
+	column     string
+	delimiter  string
+	limit      int64
+	staticSize int64
+}
+
+func (c *attachmentSizeChecker) check(recipientData any) error {
+	size := c.staticSize
+	for _, p := range recipientList(recipientData, c.column, c.delimiter) {
+		// the recipient data may come from untrusted sources, e.g. signups.
+		if !filepath.IsLocal(p) {
+			return fmt.Errorf("failed to read attachment %s: path must be inside the working directory", p)
+		}
+
+		info, err := os.Stat(filepath.Join(c.wd, p))
+		if err != nil {
+			return fmt.Errorf("failed to read attachment: %w", err)
+		}
+
+		size += email.EncodedAttachmentSize(info.Size())
+	}
+
+	if size > c.limit {
+		return fmt.Errorf("attachments exceed the message size limit of %d bytes", c.limit)
+	}
+
+	return nil
+}
+
+// checkAttachmentSizes checks the attachments of every recipient before sending
+// any emails. It reads the recipient data once more, so it mustn't be used when
+// the recipient data is read from stdin.
+func checkAttachmentSizes(wd string, cfg *config.Config, c *attachmentSizeChecker) error {
+	if c.column == "" {
+		return nil
+	}
+
+	r, err := email.NewDataReader(wd, &cfg.Message, nil)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+	for row := 1; ; row++ {
+		recipientData, err := r.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := c.check(recipientData); err != nil {
+			return fmt.Errorf("row %d: %w", row, err)
+		}
+	}
+}
+
+// recipientList returns the values in the given column of the recipient data,
+// either a delimiter-separated list or a json array.
+func recipientList(recipientData any, column string, delimiter string) []string {
+	value, _ := email.LookupValue(recipientData, column)
+	items, ok := value.([]any)
+	if !ok {
+		return splitList(email.StringValue(recipientData, column), delimiter)
+	}
+
+	values := []string{}
+	for _, item := range items {
+		if v := strings.TrimSpace(fmt.Sprint(item)); item != nil && v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// removeSuppressed returns the given addresses without the ones in the
+// suppression list.
+func removeSuppressed(l *email.SuppressionList, addresses []string) []string {
+	kept := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		if !l.IsSuppressed(a) {
+			kept = append(kept, a)
+		}
+	}
+
+	return kept
+}
+
+// splitList splits the given delimiter-separated list, dropping the empty
+// values.
+func splitList(value string, delimiter string) []string {
+	if delimiter == "" {
+		delimiter = ","
+	}
+
+	values := []string{}
+	for _, v := range strings.Split(value, delimiter) {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+const (
+	onErrorAbort = "abort"
+	onErrorSkip  = "skip"
+)
+
+func newSendSummary(isDryRun bool) *sendSummary {
+	return &sendSummary{
+		mutex:    sync.Mutex{},
+		isDryRun: isDryRun,
+		counts:   map[string]int{},
+	}
+}
+
+// sendSummary counts the recipients of a send run by their delivery status.
+type sendSummary struct {
+	mutex    sync.Mutex
+	isDryRun bool
+	counts   map[string]int
+}
+
+func (s *sendSummary) add(status string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.counts[status]++
+}
+
+func (s *sendSummary) count(status string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.counts[status]
+}
+
+func (s *sendSummary) String() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delivered := email.StatusSent
+	if s.isDryRun {
+		delivered = email.StatusDryRun
+	}
+
+	return fmt.Sprintf("%s: %d, failed: %d, skipped: %d, suppressed: %d",
+		delivered, s.counts[delivered], s.counts[email.StatusFailed], s.counts[email.StatusSkipped], s.counts[email.StatusSuppressed])
+}
+
+// dispatch sequentially reads the recipient data from `r` and invokes `process`
+// for each row that `accept` accepts on the given number of concurrent workers.
+// It stops reading further rows once `accept` returns io.EOF, or after the first
+// error and returns it once all workers exit.
+func dispatch(r email.DataReader, workers int, accept func(row int, recipientData any) (bool, error), process func(row int, recipientData any) error) error {
+	type job struct {
+		row           int
+		recipientData any
+	}
+
+	jobs := make(chan *job)
+	done := make(chan struct{})
+	var firstErr error
+	var once sync.Once
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			close(done)
+		})
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := process(j.row, j.recipientData); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+read:
+	for row := 1; ; row++ {
+		recipientData, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			fail(err)
+			break
+		}
+
+		// prefer stopping over queueing another job when both are possible.
+		select {
+		case <-done:
+			break read
+		default:
+		}
+
+		if ok, err := accept(row, recipientData); err == io.EOF {
+			break
+		} else if err != nil {
+			fail(err)
+			break
+		} else if !ok {
+			continue
+		}
+
+		select {
+		case <-done:
+			break read
+		case jobs <- &job{row: row, recipientData: recipientData}:
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	return firstErr
+}
+
+// lockedWriter serialises writes to the underlying writer.
+type lockedWriter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.w.Write(p)
+}
+
 func askConfirmation(msg string, in io.Reader, out io.Writer) bool {
 	reader := bufio.NewReader(in)
 	for {
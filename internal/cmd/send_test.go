@@ -2,6 +2,10 @@ package cmd_test
 
 import (
 	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/spf13/viper"
@@ -9,9 +13,11 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/trynoice/iris/internal/cmd"
 	"github.com/trynoice/iris/internal/testutil"
+	_ "modernc.org/sqlite"
 )
 
 func TestSendCommand(t *testing.T) {
+	t.Setenv(cmd.SuppressionStoreEnv, filepath.Join(t.TempDir(), "suppressions.txt"))
 	const subject = "test-subject-{{ .name }}"
 	const textBody = "test-text-body-{{ .name }}"
 	const htmlBody = "test-html-body-{{ .name }}"
@@ -89,5 +95,432 @@ message:
 			err := c.Execute()
 			assert.NoError(t, err)
 		})
+
+		t.Run("WithWorkers", func(t *testing.T) {
+			c := cmd.SendCommand(newViper())
+			out := &bytes.Buffer{}
+			c.SetOut(out)
+			c.SetErr(&bytes.Buffer{})
+			c.SetArgs([]string{tmpDir})
+			require.NoError(t, c.Flags().Set("dry-run", "true"))
+			require.NoError(t, c.Flags().Set("workers", "2"))
+			err := c.Execute()
+			assert.NoError(t, err)
+			assert.Contains(t, out.String(), "test-subject-abc@iris.test")
+			assert.Contains(t, out.String(), "test-subject-def@iris.test")
+		})
+
+		t.Run("WithInvalidWorkers", func(t *testing.T) {
+			c := cmd.SendCommand(newViper())
+			c.SetOut(&bytes.Buffer{})
+			c.SetErr(&bytes.Buffer{})
+			c.SetArgs([]string{tmpDir})
+			require.NoError(t, c.Flags().Set("dry-run", "true"))
+			require.NoError(t, c.Flags().Set("workers", "0"))
+			err := c.Execute()
+			assert.Error(t, err)
+		})
+	})
+
+	t.Run("WithExistingJournal", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, cfgFileContent)
+		testutil.CreateFile(t, tmpDir, "subject.txt", subject)
+		testutil.CreateFile(t, tmpDir, "body.txt", textBody)
+		testutil.CreateFile(t, tmpDir, "data.csv", "name,email\nabc,abc@iris.test")
+		require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, ".iris-state"), os.ModePerm))
+		testutil.CreateFile(t, filepath.Join(tmpDir, ".iris-state"), "journal.jsonl", `{"row":1,"address":"abc@iris.test","status":"sent"}`)
+
+		c := cmd.SendCommand(newViper())
+		out := &bytes.Buffer{}
+		c.SetOut(out)
+		c.SetErr(&bytes.Buffer{})
+		c.SetIn(strings.NewReader("y\n"))
+		c.SetArgs([]string{tmpDir})
+		assert.ErrorContains(t, c.Execute(), "--reset-journal")
+		assert.NotContains(t, out.String(), "confirm sending emails?")
+	})
+
+	t.Run("WithStdinData", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, cfgFileContent+`
+    recipientDataFormat: jsonl
+    recipientAttachmentsColumnName: files`)
+		testutil.CreateFile(t, tmpDir, "subject.txt", subject)
+		testutil.CreateFile(t, tmpDir, "body.txt", textBody)
+
+		c := cmd.SendCommand(newViper())
+		out := &bytes.Buffer{}
+		c.SetOut(out)
+		c.SetErr(&bytes.Buffer{})
+		c.SetIn(strings.NewReader(`{"name": "abc", "email": "abc@iris.test"}` + "\n" + `{"name": "def", "email": "def@iris.test"}`))
+		c.SetArgs([]string{tmpDir, "--data", "-"})
+		require.NoError(t, c.Flags().Set("dry-run", "true"))
+		err := c.Execute()
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "test-text-body-abc")
+		assert.Contains(t, out.String(), "test-text-body-def")
+	})
+
+	t.Run("WithFilter", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, cfgFileContent+`
+    filter: plan == "pro"`)
+		testutil.CreateFile(t, tmpDir, "subject.txt", subject)
+		testutil.CreateFile(t, tmpDir, "body.txt", textBody)
+		testutil.CreateFile(t, tmpDir, "data.csv", "name,email,plan\n"+
+			"abc,abc@iris.test,pro\n"+
+			"def,def@iris.test,free\n"+
+			"ghi,ghi@iris.test,pro\n"+
+			"jkl,jkl@iris.test,pro")
+
+		execute := func(t *testing.T, args ...string) string {
+			c := cmd.SendCommand(newViper())
+			out := &bytes.Buffer{}
+			c.SetOut(out)
+			c.SetErr(&bytes.Buffer{})
+			c.SetArgs(append([]string{tmpDir, "--dry-run"}, args...))
+			require.NoError(t, c.Execute())
+			return out.String()
+		}
+
+		t.Run("WithoutLimitAndOffset", func(t *testing.T) {
+			out := execute(t)
+			assert.Contains(t, out, "test-text-body-abc")
+			assert.NotContains(t, out, "test-text-body-def")
+			assert.Contains(t, out, "dry-run: 3, failed: 0, skipped: 1")
+		})
+
+		t.Run("WithLimitAndOffset", func(t *testing.T) {
+			reportFile := filepath.Join(t.TempDir(), "report.csv")
+			out := execute(t, "--offset", "1", "--limit", "1", "--report", reportFile)
+			assert.NotContains(t, out, "test-text-body-abc")
+			assert.Contains(t, out, "test-text-body-ghi")
+			assert.NotContains(t, out, "test-text-body-jkl")
+			assert.Contains(t, out, "dry-run: 1, failed: 0, skipped: 1")
+
+			data, err := os.ReadFile(reportFile)
+			require.NoError(t, err)
+			assert.Contains(t, string(data), "2,def@iris.test,skipped,0,,,\n")
+		})
+
+		t.Run("WithFilterFlag", func(t *testing.T) {
+			out := execute(t, "--filter", `plan == "free" || name == "jkl"`)
+			assert.Contains(t, out, "test-text-body-def")
+			assert.Contains(t, out, "test-text-body-jkl")
+			assert.Contains(t, out, "dry-run: 2, failed: 0, skipped: 2")
+		})
+
+		t.Run("WithInvalidFilter", func(t *testing.T) {
+			c := cmd.SendCommand(newViper())
+			c.SetOut(&bytes.Buffer{})
+			c.SetErr(&bytes.Buffer{})
+			c.SetArgs([]string{tmpDir, "--dry-run", "--filter", "plan =="})
+			assert.Error(t, c.Execute())
+		})
+
+		t.Run("WithEvaluationError", func(t *testing.T) {
+			for _, test := range []struct {
+				onError string
+				wantOut string
+			}{
+				{onError: "abort", wantOut: "dry-run: 0, failed: 1, skipped: 0"},
+				{onError: "skip", wantOut: "dry-run: 1, failed: 3, skipped: 0"},
+			} {
+				c := cmd.SendCommand(newViper())
+				out := &bytes.Buffer{}
+				c.SetOut(out)
+				c.SetErr(&bytes.Buffer{})
+				c.SetArgs([]string{tmpDir, "--dry-run", "--on-error", test.onError, "--filter", `name == "def" || int(name) > 0`})
+				assert.Error(t, c.Execute(), test.onError)
+				assert.Contains(t, out.String(), test.wantOut, test.onError)
+			}
+		})
+	})
+
+	t.Run("WithSuppressions", func(t *testing.T) {
+		suppress := cmd.SuppressCommand()
+		suppress.SetOut(&bytes.Buffer{})
+		suppress.SetArgs([]string{"add", "*.blocked.test"})
+		require.NoError(t, suppress.Execute())
+
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, cfgFileContent+`
+    recipientCcColumnName: cc
+    suppressionFiles:
+        - bounces.txt`)
+		testutil.CreateFile(t, tmpDir, "subject.txt", subject)
+		testutil.CreateFile(t, tmpDir, "body.txt", textBody)
+		testutil.CreateFile(t, tmpDir, "bounces.txt", "ABC@iris.test\nghi@iris.test")
+		testutil.CreateFile(t, tmpDir, "data.csv", "name,email,cc\n"+
+			"abc,abc@iris.test,\n"+
+			"def,def@iris.test,ghi@iris.test\n"+
+			"jkl,jkl@mail.blocked.test,")
+
+		reportFile := filepath.Join(t.TempDir(), "report.csv")
+		c := cmd.SendCommand(newViper())
+		out := &bytes.Buffer{}
+		c.SetOut(out)
+		c.SetErr(&bytes.Buffer{})
+		c.SetArgs([]string{tmpDir, "--dry-run", "--report", reportFile})
+		require.NoError(t, c.Execute())
+		assert.Contains(t, out.String(), "skipping row 1: abc@iris.test is suppressed")
+		assert.Contains(t, out.String(), "test-text-body-def")
+		assert.NotContains(t, out.String(), "ghi@iris.test")
+		assert.Contains(t, out.String(), "skipping row 3: jkl@mail.blocked.test is suppressed")
+		assert.Contains(t, out.String(), "dry-run: 1, failed: 0, skipped: 0, suppressed: 2")
+
+		data, err := os.ReadFile(reportFile)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "1,abc@iris.test,suppressed,0,,,\n")
+	})
+
+	t.Run("WithRowError", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, cfgFileContent)
+		testutil.CreateFile(t, tmpDir, "subject.txt", "{{ slice .name 0 5 }}")
+		testutil.CreateFile(t, tmpDir, "body.txt", textBody)
+		testutil.CreateFile(t, tmpDir, "body.html", htmlBody)
+		testutil.CreateFile(t, tmpDir, "data.csv", "name,email\nabcdef,abc@iris.test\nd,d@iris.test\nghijkl,ghi@iris.test")
+
+		t.Run("WithAbort", func(t *testing.T) {
+			c := cmd.SendCommand(newViper())
+			out := &bytes.Buffer{}
+			c.SetOut(out)
+			c.SetErr(&bytes.Buffer{})
+			c.SetArgs([]string{tmpDir})
+			require.NoError(t, c.Flags().Set("dry-run", "true"))
+			err := c.Execute()
+			assert.Error(t, err)
+			assert.NotContains(t, out.String(), "ghijk")
+		})
+
+		t.Run("WithSkipAndReport", func(t *testing.T) {
+			report := filepath.Join(t.TempDir(), "report.csv")
+			c := cmd.SendCommand(newViper())
+			out := &bytes.Buffer{}
+			c.SetOut(out)
+			c.SetErr(&bytes.Buffer{})
+			c.SetArgs([]string{tmpDir})
+			require.NoError(t, c.Flags().Set("dry-run", "true"))
+			require.NoError(t, c.Flags().Set("on-error", "skip"))
+			require.NoError(t, c.Flags().Set("report", report))
+			err := c.Execute()
+			assert.Error(t, err)
+			assert.Contains(t, out.String(), "ghijk")
+			assert.Contains(t, out.String(), "dry-run: 2, failed: 1, skipped: 0")
+
+			data, err := os.ReadFile(report)
+			require.NoError(t, err)
+			assert.Contains(t, string(data), "1,abc@iris.test,dry-run,1,,,\n")
+			assert.Regexp(t, `2,d@iris.test,failed,0,,.+,\n`, string(data))
+			assert.Contains(t, string(data), "3,ghi@iris.test,dry-run,1,,,\n")
+		})
+
+		t.Run("WithInvalidOnError", func(t *testing.T) {
+			c := cmd.SendCommand(newViper())
+			c.SetOut(&bytes.Buffer{})
+			c.SetErr(&bytes.Buffer{})
+			c.SetArgs([]string{tmpDir})
+			require.NoError(t, c.Flags().Set("dry-run", "true"))
+			require.NoError(t, c.Flags().Set("on-error", "ignore"))
+			err := c.Execute()
+			assert.Error(t, err)
+		})
+	})
+
+	t.Run("WithMissingKey", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, cfgFileContent+"\n    missingKeyPolicy: error")
+		testutil.CreateFile(t, tmpDir, "subject.txt", subject)
+		testutil.CreateFile(t, tmpDir, "body.txt", "test-text-body-{{ .nmae }}")
+		testutil.CreateFile(t, tmpDir, "body.html", htmlBody)
+		testutil.CreateFile(t, tmpDir, "data.csv", "name,email\nabc,abc@iris.test")
+
+		c := cmd.SendCommand(newViper())
+		c.SetOut(&bytes.Buffer{})
+		c.SetErr(&bytes.Buffer{})
+		c.SetArgs([]string{tmpDir})
+		require.NoError(t, c.Flags().Set("dry-run", "true"))
+		err := c.Execute()
+		assert.EqualError(t, err, `row 1: body.txt references missing key "nmae"`)
+	})
+
+	t.Run("WithCcAndBcc", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, cfgFileContent+`
+    recipientCcColumnName: cc
+    recipientBccColumnName: bcc
+    recipientListDelimiter: ;`)
+		testutil.CreateFile(t, tmpDir, "subject.txt", subject)
+		testutil.CreateFile(t, tmpDir, "body.txt", textBody)
+		testutil.CreateFile(t, tmpDir, "body.html", htmlBody)
+		testutil.CreateFile(t, tmpDir, "data.csv", "name,email,cc,bcc\nabc,abc@iris.test; def@iris.test,ghi@iris.test;jkl@iris.test,")
+
+		c := cmd.SendCommand(newViper())
+		out := &bytes.Buffer{}
+		c.SetOut(out)
+		c.SetErr(&bytes.Buffer{})
+		c.SetArgs([]string{tmpDir})
+		require.NoError(t, c.Flags().Set("dry-run", "true"))
+		err := c.Execute()
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "abc@iris.test, def@iris.test")
+		assert.Contains(t, out.String(), "ghi@iris.test, jkl@iris.test")
+		assert.NotContains(t, out.String(), "Bcc")
+	})
+
+	t.Run("WithJsonData", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, `
+message:
+    sender: cli@iris.test
+    recipientDataCsvFile: data.json
+    recipientEmailColumnName: email
+    recipientCcColumnName: cc`)
+		testutil.CreateFile(t, tmpDir, "subject.txt", subject)
+		testutil.CreateFile(t, tmpDir, "body.txt", "{{ range .items }}{{ .name }} x {{ .qty }}; {{ end }}")
+		testutil.CreateFile(t, tmpDir, "data.json", `[{
+			"name": "abc",
+			"email": "abc@iris.test",
+			"cc": ["def@iris.test", "ghi@iris.test"],
+			"items": [{"name": "pen", "qty": 2}, {"name": "ink", "qty": 1}]
+		}]`)
+
+		c := cmd.SendCommand(newViper())
+		out := &bytes.Buffer{}
+		c.SetOut(out)
+		c.SetErr(&bytes.Buffer{})
+		c.SetArgs([]string{tmpDir})
+		require.NoError(t, c.Flags().Set("dry-run", "true"))
+		err := c.Execute()
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "def@iris.test, ghi@iris.test")
+		assert.Contains(t, out.String(), "pen x 2; ink x 1;")
+	})
+
+	t.Run("WithSqliteSource", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, `
+message:
+    sender: cli@iris.test
+    recipientEmailColumnName: email
+    recipientSource:
+        type: sqlite
+        database: app.db
+        query: SELECT name, email FROM users WHERE active`)
+		testutil.CreateFile(t, tmpDir, "subject.txt", subject)
+		testutil.CreateFile(t, tmpDir, "body.txt", textBody)
+
+		db, err := sql.Open("sqlite", filepath.Join(tmpDir, "app.db"))
+		require.NoError(t, err)
+		_, err = db.Exec(`CREATE TABLE users (name TEXT, email TEXT, active BOOLEAN);
+			INSERT INTO users VALUES ('abc', 'abc@iris.test', TRUE), ('def', 'def@iris.test', FALSE);`)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		c := cmd.SendCommand(newViper())
+		out := &bytes.Buffer{}
+		c.SetOut(out)
+		c.SetErr(&bytes.Buffer{})
+		c.SetArgs([]string{tmpDir})
+		require.NoError(t, c.Flags().Set("dry-run", "true"))
+		err = c.Execute()
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "test-text-body-abc")
+		assert.NotContains(t, out.String(), "def@iris.test")
+	})
+
+	t.Run("WithAttachments", func(t *testing.T) {
+		newWorkingDir := func(t *testing.T, cfg string, data string) string {
+			tmpDir := t.TempDir()
+			testutil.CreateFile(t, tmpDir, cfgFile, cfg)
+			testutil.CreateFile(t, tmpDir, "subject.txt", subject)
+			testutil.CreateFile(t, tmpDir, "body.txt", textBody)
+			testutil.CreateFile(t, tmpDir, "body.html", htmlBody)
+			testutil.CreateFile(t, tmpDir, "data.csv", data)
+			testutil.CreateFile(t, tmpDir, "static.txt", "test-static-attachment")
+			testutil.CreateFile(t, tmpDir, "abc.txt", "test-abc-attachment")
+			return tmpDir
+		}
+
+		attachmentsCfg := cfgFileContent + `
+    attachments: [static.txt]
+    recipientAttachmentsColumnName: files`
+
+		t.Run("WithExistingFiles", func(t *testing.T) {
+			tmpDir := newWorkingDir(t, attachmentsCfg, "name,files\nabc,abc.txt\ndef,")
+			c := cmd.SendCommand(newViper())
+			out := &bytes.Buffer{}
+			c.SetOut(out)
+			c.SetErr(&bytes.Buffer{})
+			c.SetArgs([]string{tmpDir})
+			require.NoError(t, c.Flags().Set("dry-run", "true"))
+			err := c.Execute()
+			assert.NoError(t, err)
+			assert.Contains(t, out.String(), "static.txt (22 bytes)")
+			assert.Contains(t, out.String(), "abc.txt (19 bytes)")
+		})
+
+		t.Run("WithMissingFile", func(t *testing.T) {
+			tmpDir := newWorkingDir(t, attachmentsCfg, "name,files\nabc,abc.txt\ndef,def.txt")
+			c := cmd.SendCommand(newViper())
+			out := &bytes.Buffer{}
+			c.SetOut(out)
+			c.SetErr(&bytes.Buffer{})
+			c.SetArgs([]string{tmpDir})
+			require.NoError(t, c.Flags().Set("dry-run", "true"))
+			err := c.Execute()
+			assert.ErrorContains(t, err, "row 2")
+			assert.NotContains(t, out.String(), "abc.txt")
+		})
+
+		t.Run("WithFileOutsideWorkingDir", func(t *testing.T) {
+			for _, path := range []string{"../abc.txt", "/etc/hosts", "sub/../../abc.txt"} {
+				tmpDir := newWorkingDir(t, attachmentsCfg, "name,files\nabc,"+path)
+				c := cmd.SendCommand(newViper())
+				out := &bytes.Buffer{}
+				c.SetOut(out)
+				c.SetErr(&bytes.Buffer{})
+				c.SetArgs([]string{tmpDir})
+				require.NoError(t, c.Flags().Set("dry-run", "true"))
+				err := c.Execute()
+				assert.ErrorContains(t, err, "path must be inside the working directory", path)
+				assert.NotContains(t, out.String(), "abc.txt", path)
+			}
+		})
+
+		t.Run("WithOversizedFile", func(t *testing.T) {
+			tmpDir := newWorkingDir(t, `
+service:
+    smtp:
+        maxMessageSize: 50
+message:
+    recipientDataCsvFile: data.csv
+    attachments: [static.txt]
+    recipientAttachmentsColumnName: files`, "name,files\nabc,abc.txt\ndef,")
+			c := cmd.SendCommand(newViper())
+			out := &bytes.Buffer{}
+			c.SetOut(out)
+			c.SetErr(&bytes.Buffer{})
+			c.SetArgs([]string{tmpDir})
+			require.NoError(t, c.Flags().Set("dry-run", "true"))
+			err := c.Execute()
+			assert.ErrorContains(t, err, "row 1")
+		})
+
+		t.Run("WithStdinData", func(t *testing.T) {
+			tmpDir := newWorkingDir(t, attachmentsCfg, "")
+			c := cmd.SendCommand(newViper())
+			out := &bytes.Buffer{}
+			c.SetOut(out)
+			c.SetErr(&bytes.Buffer{})
+			c.SetIn(strings.NewReader("name,email,files\nabc,abc@iris.test,abc.txt\ndef,def@iris.test,def.txt"))
+			c.SetArgs([]string{tmpDir, "--data", "-"})
+			require.NoError(t, c.Flags().Set("dry-run", "true"))
+			err := c.Execute()
+			assert.ErrorContains(t, err, "row 2")
+			assert.Contains(t, out.String(), "abc.txt (19 bytes)")
+		})
 	})
 }
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/trynoice/iris/internal/config"
+	"github.com/trynoice/iris/internal/email"
+)
+
+func SuppressCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "suppress",
+		Short: "Manage the addresses and domains that never receive emails",
+	}
+
+	c.AddCommand(&cobra.Command{
+		Use:   "add <address|domain>...",
+		Short: "Add addresses or domains, e.g. '*.example.test', to the suppression store",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return updateSuppressionStore(cmd, args, (*email.SuppressionStore).Add, "added", "already suppressed")
+		},
+	})
+
+	c.AddCommand(&cobra.Command{
+		Use:   "remove <address|domain>...",
+		Short: "Remove addresses or domains from the suppression store",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return updateSuppressionStore(cmd, args, (*email.SuppressionStore).Remove, "removed", "not suppressed")
+		},
+	})
+
+	c.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the entries in the suppression store",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := openSuppressionStore()
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range s.Entries() {
+				cmd.Println(entry)
+			}
+
+			return nil
+		},
+	})
+
+	return c
+}
+
+// updateSuppressionStore applies `update` to each entry and saves the store
+// only if all entries are valid.
+func updateSuppressionStore(
+	cmd *cobra.Command,
+	entries []string,
+	update func(s *email.SuppressionStore, entry string) (bool, error),
+	updated string,
+	unchanged string,
+) error {
+	s, err := openSuppressionStore()
+	if err != nil {
+		return err
+	}
+
+	messages := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ok, err := update(s, entry)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			messages = append(messages, fmt.Sprintf("%s %s", updated, entry))
+		} else {
+			messages = append(messages, fmt.Sprintf("%s: %s", unchanged, entry))
+		}
+	}
+
+	if err := s.Save(); err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		cmd.Println(m)
+	}
+
+	return nil
+}
+
+// SuppressionStoreEnv is the environment variable that overrides the path of
+// the suppression store.
+const SuppressionStoreEnv = "IRIS_SUPPRESSION_STORE"
+
+// openSuppressionStore opens the suppression store in the user's config
+// directory, since it applies to the emails of all working directories, unless
+// SuppressionStoreEnv overrides its path.
+func openSuppressionStore() (*email.SuppressionStore, error) {
+	if name := os.Getenv(SuppressionStoreEnv); name != "" {
+		return email.OpenSuppressionStore(name)
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find suppression store: %w", err)
+	}
+
+	return email.OpenSuppressionStore(filepath.Join(dir, "iris", "suppressions.txt"))
+}
+
+// loadSuppressionList loads the entries of the suppression store and the
+// suppression files of the given config.
+func loadSuppressionList(wd string, cfg *config.Config) (*email.SuppressionList, error) {
+	s, err := openSuppressionStore()
+	if err != nil {
+		return nil, err
+	}
+
+	l := email.NewSuppressionList()
+	if err := s.AddTo(l); err != nil {
+		return nil, err
+	}
+
+	for _, name := range cfg.Message.SuppressionFiles {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(wd, name)
+		}
+
+		if err := l.Load(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
@@ -0,0 +1,46 @@
+package cmd_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trynoice/iris/internal/cmd"
+)
+
+func TestSuppressCommand(t *testing.T) {
+	t.Setenv(cmd.SuppressionStoreEnv, filepath.Join(t.TempDir(), "suppressions.txt"))
+	execute := func(t *testing.T, args ...string) (string, error) {
+		out := &bytes.Buffer{}
+		c := cmd.SuppressCommand()
+		c.SetOut(out)
+		c.SetErr(out)
+		c.SetArgs(args)
+		err := c.Execute()
+		return out.String(), err
+	}
+
+	out, err := execute(t, "add", "jack@iris.test", "*.wild.test")
+	assert.NoError(t, err)
+	assert.Equal(t, "added jack@iris.test\nadded *.wild.test\n", out)
+
+	out, err = execute(t, "add", "JACK@iris.test")
+	assert.NoError(t, err)
+	assert.Equal(t, "already suppressed: JACK@iris.test\n", out)
+
+	_, err = execute(t, "add", "jill@iris.test", "jack@")
+	assert.Error(t, err)
+
+	out, err = execute(t, "list")
+	assert.NoError(t, err)
+	assert.Equal(t, "*.wild.test\njack@iris.test\n", out)
+
+	out, err = execute(t, "remove", "jack@iris.test", "jill@iris.test")
+	assert.NoError(t, err)
+	assert.Equal(t, "removed jack@iris.test\nnot suppressed: jill@iris.test\n", out)
+
+	out, err = execute(t, "list")
+	assert.NoError(t, err)
+	assert.Equal(t, "*.wild.test\n", out)
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	netmail "net/mail"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/trynoice/iris/internal/config"
+	"github.com/trynoice/iris/internal/email"
+)
+
+func ValidateCommand(v *viper.Viper) *cobra.Command {
+	dataFile := ""
+	c := &cobra.Command{
+		Use:   "validate [dir]",
+		Short: "Check the working files in the given directory without sending emails",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			wd := "."
+			if len(args) > 0 {
+				wd = args[0]
+			}
+
+			v.AddConfigPath(wd)
+			cfg, err := config.ReadStrict(v)
+			if err != nil {
+				return err
+			}
+
+			if cmd.Flags().Changed("data") {
+				cfg.Message.RecipientDataCsvFile = dataFile
+				cfg.Message.RecipientSource = nil
+			}
+
+			problems := []string{}
+			report := func(format string, a ...any) {
+				problems = append(problems, fmt.Sprintf(format, a...))
+			}
+
+			if cfg.Service.AwsSes == nil && cfg.Service.Smtp == nil {
+				report("config: no email service is configured")
+			} else if cfg.Service.AwsSes != nil && cfg.Service.Smtp != nil {
+				report("config: both awsSes and smtp services are configured")
+			}
+
+			if _, err := netmail.ParseAddress(cfg.Message.Sender); err != nil {
+				report("config: invalid sender address %q: %v", cfg.Message.Sender, err)
+			}
+
+			for _, a := range cfg.Message.ReplyToAddresses {
+				if _, err := netmail.ParseAddress(a); err != nil {
+					report("config: invalid reply-to address %q: %v", a, err)
+				}
+			}
+
+			if cfg.Message.RecipientEmailColumnName == "" {
+				report("config: recipient email column name is empty")
+			}
+
+			if cfg.Message.Filter != "" {
+				if _, err := email.NewFilter(cfg.Message.Filter); err != nil {
+					report("config: %v", err)
+				}
+			}
+
+			if _, err := loadSuppressionList(wd, cfg); err != nil {
+				report("suppressions: %v", err)
+			}
+
+			t, err := email.NewTemplate(wd, &cfg.Message)
+			if err != nil {
+				report("templates: %v", err)
+			} else {
+				// catch typos in template keys instead of rendering `<no value>`.
+				t.Option("missingkey=error")
+			}
+
+			attachments := make([]*email.Attachment, 0, len(cfg.Message.Attachments))
+			for _, p := range cfg.Message.Attachments {
+				if a, err := email.LoadAttachment(wd, p); err != nil {
+					report("attachments: %v", err)
+				} else {
+					attachments = append(attachments, a)
+				}
+			}
+
+			sizeChecker, err := newAttachmentSizeChecker(wd, cfg, attachments)
+			if err != nil {
+				report("attachments: %v", err)
+			}
+
+			r, err := email.NewDataReader(wd, &cfg.Message, cmd.InOrStdin())
+			if err != nil {
+				report("recipient data: %v", err)
+			} else {
+				defer r.Close()
+				validateRecipientData(cfg, r, t, sizeChecker, report)
+			}
+
+			for _, p := range problems {
+				cmd.Println(p)
+			}
+
+			if len(problems) > 0 {
+				return fmt.Errorf("found %d problem(s)", len(problems))
+			}
+
+			cmd.Println("no problems found")
+			return nil
+		},
+	}
+
+	c.Flags().StringVar(&dataFile, "data", dataFile, "read the recipient data from the given file, or from stdin if it is '-'")
+	return c
+}
+
+// validateRecipientData checks the addresses of each recipient, looks for
+// duplicate recipients, checks the attachments if `sizeChecker` isn't nil, and
+// checks the locales and renders the email templates for each of them if `t`
+// isn't nil.
+func validateRecipientData(
+	cfg *config.Config,
+	r email.DataReader,
+	t *email.Template,
+	sizeChecker *attachmentSizeChecker,
+	report func(format string, a ...any),
+) {
+	firstRows := map[string]int{}
+	missingLocales := map[string]bool{}
+	for row := 1; ; row++ {
+		recipientData, err := r.Read()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			report("row %d: %v", row, err)
+			return
+		}
+
+		if _, ok := email.LookupValue(recipientData, cfg.Message.RecipientEmailColumnName); !ok {
+			report("recipient data: column %q not found", cfg.Message.RecipientEmailColumnName)
+			return
+		}
+
+		to := recipientList(recipientData, cfg.Message.RecipientEmailColumnName, cfg.Message.RecipientListDelimiter)
+		if len(to) == 0 {
+			report("row %d: recipient address is empty", row)
+		}
+
+		for _, column := range []string{
+			cfg.Message.RecipientEmailColumnName,
+			cfg.Message.RecipientCcColumnName,
+			cfg.Message.RecipientBccColumnName,
+		} {
+			for _, a := range recipientList(recipientData, column, cfg.Message.RecipientListDelimiter) {
+				if _, err := netmail.ParseAddress(a); err != nil {
+					report("row %d: invalid address %q: %v", row, a, err)
+				}
+			}
+		}
+
+		for _, a := range to {
+			key := strings.ToLower(a)
+			if addr, err := netmail.ParseAddress(a); err == nil {
+				key = strings.ToLower(addr.Address)
+			}
+
+			if firstRow, ok := firstRows[key]; ok {
+				report("row %d: duplicate recipient %s, first seen on row %d", row, a, firstRow)
+			} else {
+				firstRows[key] = row
+			}
+		}
+
+		if sizeChecker != nil {
+			if err := sizeChecker.check(recipientData); err != nil {
+				report("row %d: %v", row, err)
+			}
+		}
+
+		if locale := email.StringValue(recipientData, cfg.Message.LocaleColumnName); t != nil && locale != "" && !t.HasLocale(locale) && !missingLocales[locale] {
+			missingLocales[locale] = true
+			report("row %d: locale %q has no templates, it falls back to the default locale", row, locale)
+		}
+
+		if t != nil {
+			if _, err := t.Render(recipientData); err != nil {
+				report("row %d: %v", row, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package cmd_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/trynoice/iris/internal/cmd"
+	"github.com/trynoice/iris/internal/testutil"
+)
+
+func TestValidateCommand(t *testing.T) {
+	t.Setenv(cmd.SuppressionStoreEnv, filepath.Join(t.TempDir(), "suppressions.txt"))
+	const cfgFile = ".iris.yaml"
+	const cfgFileContent = `
+service:
+    smtp:
+        host: localhost
+        port: 25
+message:
+    sender: cli@iris.test
+    recipientDataCsvFile: data.csv
+    recipientEmailColumnName: email`
+
+	newViper := func() *viper.Viper {
+		v := viper.New()
+		v.SetConfigName(".iris")
+		v.SetConfigType("yaml")
+		return v
+	}
+
+	execute := func(t *testing.T, dir string) (string, error) {
+		out := &bytes.Buffer{}
+		c := cmd.ValidateCommand(newViper())
+		c.SetOut(out)
+		c.SetErr(out)
+		c.SetArgs([]string{dir})
+		err := c.Execute()
+		return out.String(), err
+	}
+
+	createTemplates := func(t *testing.T, dir string) {
+		testutil.CreateFile(t, dir, "subject.txt", "subject-{{ .name }}")
+		testutil.CreateFile(t, dir, "body.txt", "text-body-{{ .name }}")
+		testutil.CreateFile(t, dir, "body.html", "html-body-{{ .name }}")
+	}
+
+	t.Run("WithValidFiles", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, cfgFileContent)
+		testutil.CreateFile(t, tmpDir, "data.csv", "email,name\nabc@iris.test,abc\ndef@iris.test,def")
+		createTemplates(t, tmpDir)
+
+		out, err := execute(t, tmpDir)
+		assert.NoError(t, err)
+		assert.Contains(t, out, "no problems found")
+	})
+
+	t.Run("WithStdinData", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, cfgFileContent)
+		createTemplates(t, tmpDir)
+
+		out := &bytes.Buffer{}
+		c := cmd.ValidateCommand(newViper())
+		c.SetOut(out)
+		c.SetErr(out)
+		c.SetIn(strings.NewReader("email,name\nabc@iris.test,abc\nabc@iris.test,def"))
+		c.SetArgs([]string{tmpDir, "--data", "-"})
+		assert.Error(t, c.Execute())
+		assert.Contains(t, out.String(), "row 2: duplicate recipient abc@iris.test, first seen on row 1")
+	})
+
+	t.Run("WithUnknownConfigKey", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, cfgFileContent+"\n    recipientEmailColumName: email")
+		testutil.CreateFile(t, tmpDir, "data.csv", "email,name\nabc@iris.test,abc")
+		createTemplates(t, tmpDir)
+
+		_, err := execute(t, tmpDir)
+		assert.ErrorContains(t, err, "recipientemailcolumname")
+	})
+
+	t.Run("WithoutService", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, `
+message:
+    sender: cli@iris.test
+    recipientDataCsvFile: data.csv
+    recipientEmailColumnName: email`)
+		testutil.CreateFile(t, tmpDir, "data.csv", "email,name\nabc@iris.test,abc")
+		createTemplates(t, tmpDir)
+
+		out, err := execute(t, tmpDir)
+		assert.Error(t, err)
+		assert.Contains(t, out, "no email service is configured")
+	})
+
+	t.Run("WithInvalidRecipientData", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, cfgFileContent)
+		testutil.CreateFile(t, tmpDir, "data.csv", "email,nmae\nabc@iris.test,abc\ninvalid,def\nABC@iris.test,ghi")
+		createTemplates(t, tmpDir)
+
+		out, err := execute(t, tmpDir)
+		assert.ErrorContains(t, err, "found 5 problem(s)")
+		assert.Contains(t, out, "row 1:")
+		assert.Contains(t, out, `row 2: invalid address "invalid"`)
+		assert.Contains(t, out, "row 3: duplicate recipient ABC@iris.test, first seen on row 1")
+	})
+
+	t.Run("WithMissingLocale", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, cfgFile, cfgFileContent+"\n    localeColumnName: locale")
+		testutil.CreateFile(t, tmpDir, "data.csv", "email,name,locale\nabc@iris.test,abc,de\ndef@iris.test,def,fr\nghi@iris.test,ghi,fr\njkl@iris.test,jkl,")
+		createTemplates(t, tmpDir)
+		testutil.CreateFile(t, tmpDir, "subject.de.txt", "betreff-{{ .name }}")
+		testutil.CreateFile(t, tmpDir, "body.de.txt", "text-{{ .name }}")
+
+		out, err := execute(t, tmpDir)
+		assert.ErrorContains(t, err, "found 1 problem(s)")
+		assert.Contains(t, out, `row 2: locale "fr" has no templates`)
+	})
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
@@ -14,10 +15,14 @@ type Config struct {
 }
 
 type ServiceConfig struct {
-	AwsSes    *AwsSesServiceConfig `yaml:"awsSes,omitempty"`
-	Smtp      *SmtpServiceConfig   `yaml:"smtp,omitempty"`
-	RateLimit int                  `yaml:"rateLimit,omitempty"`
-	Retries   int                  `yaml:"retries,omitempty"`
+	AwsSes         *AwsSesServiceConfig `yaml:"awsSes,omitempty"`
+	Smtp           *SmtpServiceConfig   `yaml:"smtp,omitempty"`
+	RateLimit      int                  `yaml:"rateLimit,omitempty"`
+	Retries        int                  `yaml:"retries,omitempty"`
+	RetryBaseDelay time.Duration        `yaml:"retryBaseDelay,omitempty"`
+	RetryMaxDelay  time.Duration        `yaml:"retryMaxDelay,omitempty"`
+	RetryJitter    float64              `yaml:"retryJitter,omitempty"`
+	Concurrency    int                  `yaml:"concurrency,omitempty"`
 }
 
 type AwsSesServiceConfig struct {
@@ -27,29 +32,95 @@ type AwsSesServiceConfig struct {
 }
 
 type SmtpServiceConfig struct {
-	Host       string `yaml:"host,omitempty"`
-	Port       int    `yaml:"port,omitempty"`
-	Username   string `yaml:"username,omitempty"`
-	Password   string `yaml:"password,omitempty"`
-	Encryption string `yaml:"encryption,omitempty"`
+	Host           string      `yaml:"host,omitempty"`
+	Port           int         `yaml:"port,omitempty"`
+	Username       string      `yaml:"username,omitempty"`
+	Password       string      `yaml:"password,omitempty"`
+	Encryption     string      `yaml:"encryption,omitempty"`
+	MaxMessageSize int         `yaml:"maxMessageSize,omitempty"`
+	Dkim           *DkimConfig `yaml:"dkim,omitempty"`
+}
+
+type DkimConfig struct {
+	PrivateKeyFile   string   `yaml:"privateKeyFile,omitempty"`
+	Selector         string   `yaml:"selector,omitempty"`
+	Domain           string   `yaml:"domain,omitempty"`
+	Headers          []string `yaml:"headers,omitempty"`
+	Canonicalization string   `yaml:"canonicalization,omitempty"`
 }
 
 type MessageConfig struct {
-	Sender                   string   `yaml:"sender,omitempty"`
-	ReplyToAddresses         []string `yaml:"replyToAddresses,omitempty"`
-	DefaultDataCsvFile       string   `yaml:"defaultDataCsvFile,omitempty"`
-	RecipientDataCsvFile     string   `yaml:"recipientDataCsvFile,omitempty"`
-	RecipientEmailColumnName string   `yaml:"recipientEmailColumnName,omitempty"`
-	MinifyHtml               bool     `yaml:"minifyHtml,omitempty"`
+	Sender                         string                 `yaml:"sender,omitempty"`
+	ReplyToAddresses               []string               `yaml:"replyToAddresses,omitempty"`
+	DefaultDataCsvFile             string                 `yaml:"defaultDataCsvFile,omitempty"`
+	RecipientDataCsvFile           string                 `yaml:"recipientDataCsvFile,omitempty"`
+	RecipientDataFormat            string                 `yaml:"recipientDataFormat,omitempty"`
+	RecipientSource                *RecipientSourceConfig `yaml:"recipientSource,omitempty"`
+	Csv                            CsvConfig              `yaml:"csv,omitempty"`
+	Filter                         string                 `yaml:"filter,omitempty"`
+	SuppressionFiles               []string               `yaml:"suppressionFiles,omitempty"`
+	RecipientEmailColumnName       string                 `yaml:"recipientEmailColumnName,omitempty"`
+	RecipientCcColumnName          string                 `yaml:"recipientCcColumnName,omitempty"`
+	RecipientBccColumnName         string                 `yaml:"recipientBccColumnName,omitempty"`
+	RecipientListDelimiter         string                 `yaml:"recipientListDelimiter,omitempty"`
+	Attachments                    []string               `yaml:"attachments,omitempty"`
+	RecipientAttachmentsColumnName string                 `yaml:"recipientAttachmentsColumnName,omitempty"`
+	MinifyHtml                     bool                   `yaml:"minifyHtml,omitempty"`
+	InlineCss                      bool                   `yaml:"inlineCss,omitempty"`
+	MissingKeyPolicy               string                 `yaml:"missingKeyPolicy,omitempty"`
+	RawHtmlColumnNames             []string               `yaml:"rawHtmlColumnNames,omitempty"`
+	PartialsDir                    string                 `yaml:"partialsDir,omitempty"`
+	LocaleColumnName               string                 `yaml:"localeColumnName,omitempty"`
+	DefaultLocale                  string                 `yaml:"defaultLocale,omitempty"`
+	Variants                       []VariantConfig        `yaml:"variants,omitempty"`
+	VariantSeed                    string                 `yaml:"variantSeed,omitempty"`
+	Headers                        map[string]string      `yaml:"headers,omitempty"`
+	ListUnsubscribe                string                 `yaml:"listUnsubscribe,omitempty"`
+	ListUnsubscribeOneClick        bool                   `yaml:"listUnsubscribeOneClick,omitempty"`
+}
+
+type CsvConfig struct {
+	Delimiter        string `yaml:"delimiter,omitempty"`
+	Comment          string `yaml:"comment,omitempty"`
+	LazyQuotes       bool   `yaml:"lazyQuotes,omitempty"`
+	TrimLeadingSpace bool   `yaml:"trimLeadingSpace,omitempty"`
+	Encoding         string `yaml:"encoding,omitempty"`
+}
+
+type RecipientSourceConfig struct {
+	Type     string `yaml:"type,omitempty"`
+	Database string `yaml:"database,omitempty"`
+	Query    string `yaml:"query,omitempty"`
+}
+
+type VariantConfig struct {
+	Name   string `yaml:"name"`
+	Weight int    `yaml:"weight"`
 }
 
 // Read attempts to read the config file in the current working directory. It
 // falls back to sensible defaults if the entire config file or some config
 // options are not provided.
 func Read(v *viper.Viper) (*Config, error) {
+	return read(v, false)
+}
+
+// ReadStrict is like Read, but it also fails if the config file contains
+// unknown options.
+func ReadStrict(v *viper.Viper) (*Config, error) {
+	return read(v, true)
+}
+
+func read(v *viper.Viper, strict bool) (*Config, error) {
 	v.SetDefault("service.rateLimit", 10)
 	v.SetDefault("service.retries", 3)
+	v.SetDefault("service.retryBaseDelay", time.Second)
+	v.SetDefault("service.retryMaxDelay", 30*time.Second)
+	v.SetDefault("service.retryJitter", 0.5)
+	v.SetDefault("service.concurrency", 1)
 	v.SetDefault("message.minifyHtml", true)
+	v.SetDefault("message.missingKeyPolicy", "default")
+	v.SetDefault("message.recipientListDelimiter", ",")
 
 	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -58,7 +129,12 @@ func Read(v *viper.Viper) (*Config, error) {
 	}
 
 	cfg := &Config{}
-	if err := v.Unmarshal(cfg); err != nil {
+	unmarshal := v.Unmarshal
+	if strict {
+		unmarshal = v.UnmarshalExact
+	}
+
+	if err := unmarshal(cfg); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
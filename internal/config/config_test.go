@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
@@ -24,9 +25,42 @@ func TestRead(t *testing.T) {
 		got, err := config.Read(v)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, got.Service.RateLimit)
+		assert.NotEmpty(t, got.Service.RetryBaseDelay)
 		assert.NotEmpty(t, got.Message.MinifyHtml)
 	})
 
+	t.Run("WithDurations", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		err := os.WriteFile(filepath.Join(tmpDir, ".iris.yaml"), []byte("service:\n    retryMaxDelay: 1m30s"), os.ModePerm)
+		require.NoError(t, err)
+
+		v := viper.New()
+		v.AddConfigPath(tmpDir)
+		v.SetConfigName(".iris")
+		v.SetConfigType("yaml")
+
+		got, err := config.Read(v)
+		assert.NoError(t, err)
+		assert.Equal(t, 90*time.Second, got.Service.RetryMaxDelay)
+	})
+
+	t.Run("WithUnknownOptions", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		err := os.WriteFile(filepath.Join(tmpDir, ".iris.yaml"), []byte("service:\n    rateLimt: 1"), os.ModePerm)
+		require.NoError(t, err)
+
+		v := viper.New()
+		v.AddConfigPath(tmpDir)
+		v.SetConfigName(".iris")
+		v.SetConfigType("yaml")
+
+		_, err = config.Read(v)
+		assert.NoError(t, err)
+
+		_, err = config.ReadStrict(v)
+		assert.Error(t, err)
+	})
+
 	t.Run("WithConfigFile", func(t *testing.T) {
 		tmpDir := t.TempDir()
 		want := &config.Config{
@@ -0,0 +1,44 @@
+package email
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// AwsSesMaxMessageSize is the maximum size of a raw message accepted by
+	// AWS SES.
+	AwsSesMaxMessageSize = 10 * 1024 * 1024
+
+	// DefaultSmtpMaxMessageSize is the maximum message size assumed for SMTP
+	// servers if it isn't configured. Most servers accept at least 25 MB.
+	DefaultSmtpMaxMessageSize = 25 * 1024 * 1024
+)
+
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// LoadAttachment reads the file at the given path relative to the given dir.
+func LoadAttachment(dir string, path string) (*Attachment, error) {
+	data, err := os.ReadFile(filepath.Join(dir, path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	return &Attachment{
+		Name: filepath.Base(path),
+		Data: data,
+	}, nil
+}
+
+// EncodedAttachmentSize estimates the number of bytes that an attachment of
+// the given size occupies in a MIME message, i.e. after base64 encoding and
+// wrapping it in 76 character lines.
+func EncodedAttachmentSize(size int64) int64 {
+	n := int64(base64.StdEncoding.EncodedLen(int(size)))
+	return n + (n/76)*2
+}
@@ -0,0 +1,36 @@
+package email_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trynoice/iris/internal/email"
+	"github.com/trynoice/iris/internal/testutil"
+)
+
+func TestLoadAttachment(t *testing.T) {
+	t.Run("WithExistingFile", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, "test.txt", "test-attachment")
+
+		a, err := email.LoadAttachment(tmpDir, "test.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "test.txt", a.Name)
+		assert.Equal(t, []byte("test-attachment"), a.Data)
+	})
+
+	t.Run("WithNonExistingFile", func(t *testing.T) {
+		a, err := email.LoadAttachment(t.TempDir(), "test.txt")
+		assert.Error(t, err)
+		assert.Nil(t, a)
+	})
+}
+
+func TestEncodedAttachmentSize(t *testing.T) {
+	for _, size := range []int{0, 1, 57, 1000, 1024 * 1024} {
+		encoded := base64.StdEncoding.EncodeToString(make([]byte, size))
+		lines := (len(encoded) + 75) / 76
+		assert.GreaterOrEqual(t, email.EncodedAttachmentSize(int64(size)), int64(len(encoded)+(lines-1)*2))
+	}
+}
@@ -0,0 +1,311 @@
+package email
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	cssCommentPattern = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	importantPattern  = regexp.MustCompile(`(?i)\s*!\s*important\s*$`)
+
+	// dynamicPseudoClassPattern matches the selectors that depend on the user
+	// interaction, so they can't be inlined.
+	dynamicPseudoClassPattern = regexp.MustCompile(`(?i)(^|[^:]):(hover|active|focus|focus-within|focus-visible|visited|link|target)\b`)
+)
+
+type cssRule struct {
+	selectors    []string
+	body         string
+	declarations []*cssDeclaration
+}
+
+type cssDeclaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+type cssMatch struct {
+	specificity  cascadia.Specificity
+	declarations []*cssDeclaration
+}
+
+// inlineStyles moves the rules in the `<style>` elements of the given html
+// document to the `style` attributes of the matching elements. It keeps the
+// rules that can't be inlined, e.g. media queries and `:hover` rules, in a
+// `<style>` element in the document head.
+func inlineStyles(s string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse html body: %w", err)
+	}
+
+	var head *html.Node
+	styles := []*html.Node{}
+	var find func(n *html.Node)
+	find = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Head && head == nil {
+			head = n
+		} else if n.Type == html.ElementNode && n.DataAtom == atom.Style {
+			styles = append(styles, n)
+			return
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+
+	find(doc)
+	if len(styles) == 0 {
+		return s, nil
+	}
+
+	rules, statements, kept := []*cssRule{}, []string{}, []string{}
+	for _, style := range styles {
+		b := strings.Builder{}
+		for c := style.FirstChild; c != nil; c = c.NextSibling {
+			b.WriteString(c.Data)
+		}
+
+		r, st, k := parseCss(b.String())
+		rules = append(rules, r...)
+		statements = append(statements, st...)
+		kept = append(kept, k...)
+		style.Parent.RemoveChild(style)
+	}
+
+	matches := map[*html.Node][]*cssMatch{}
+	for _, rule := range rules {
+		for _, selector := range rule.selectors {
+			sel, err := cascadia.Parse(selector)
+			if err != nil || dynamicPseudoClassPattern.MatchString(selector) {
+				kept = append(kept, selector+" {"+rule.body+"}")
+				continue
+			}
+
+			for _, n := range cascadia.QueryAll(doc, sel) {
+				matches[n] = append(matches[n], &cssMatch{specificity: sel.Specificity(), declarations: rule.declarations})
+			}
+		}
+	}
+
+	for n, m := range matches {
+		// the later rules override the earlier rules with the same specificity.
+		sort.SliceStable(m, func(i, j int) bool {
+			return m[i].specificity.Less(m[j].specificity)
+		})
+
+		style := newInlineStyle()
+		for _, match := range m {
+			style.set(match.declarations)
+		}
+
+		for i, attr := range n.Attr {
+			if attr.Key == "style" {
+				// the declarations in the style attribute take precedence.
+				style.set(parseCssDeclarations(attr.Val))
+				n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+				break
+			}
+		}
+
+		if v := style.String(); v != "" {
+			n.Attr = append(n.Attr, html.Attribute{Key: "style", Val: v})
+		}
+	}
+
+	// browsers ignore the statement at-rules, e.g. `@import`, after other rules.
+	kept = append(statements, kept...)
+	if len(kept) > 0 && head != nil {
+		style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+		style.AppendChild(&html.Node{Type: html.TextNode, Data: strings.Join(kept, "\n")})
+		head.AppendChild(style)
+	}
+
+	b := &strings.Builder{}
+	if err := html.Render(b, doc); err != nil {
+		return "", fmt.Errorf("failed to render html body: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+// parseCss splits the given stylesheet into the rules that can be inlined, the
+// statement at-rules, e.g. `@import`, and the block at-rules, e.g. media
+// queries, that must be kept as is. An unclosed block runs to the end of the
+// stylesheet.
+func parseCss(css string) ([]*cssRule, []string, []string) {
+	css = cssCommentPattern.ReplaceAllString(css, "")
+	rules, statements, kept := []*cssRule{}, []string{}, []string{}
+	for i := 0; i < len(css); {
+		if strings.TrimSpace(css[i:]) == "" {
+			break
+		}
+
+		end := indexOutside(css, i, "{;")
+		if end == len(css) {
+			kept = append(kept, strings.TrimSpace(css[i:]))
+			break
+		}
+
+		if css[end] == ';' {
+			// a statement at-rule, e.g. `@import url(...);`.
+			statements = append(statements, strings.TrimSpace(css[i:end+1]))
+			i = end + 1
+			continue
+		}
+
+		closing := matchingBrace(css, end)
+		prelude := strings.TrimSpace(css[i:end])
+		if strings.HasPrefix(prelude, "@") {
+			block := css[end:]
+			if closing < len(css) {
+				block = css[end : closing+1]
+			}
+
+			kept = append(kept, prelude+" "+strings.TrimSpace(block))
+		} else {
+			body := css[end+1 : closing]
+			selectors := []string{}
+			for _, s := range splitOutside(prelude, ',') {
+				if s = strings.TrimSpace(s); s != "" {
+					selectors = append(selectors, s)
+				}
+			}
+
+			rules = append(rules, &cssRule{
+				selectors:    selectors,
+				body:         body,
+				declarations: parseCssDeclarations(body),
+			})
+		}
+
+		i = closing + 1
+	}
+
+	return rules, statements, kept
+}
+
+func parseCssDeclarations(s string) []*cssDeclaration {
+	declarations := []*cssDeclaration{}
+	for _, d := range splitOutside(s, ';') {
+		property, value, ok := strings.Cut(d, ":")
+		property = strings.ToLower(strings.TrimSpace(property))
+		value = strings.TrimSpace(value)
+		if !ok || property == "" || value == "" {
+			continue
+		}
+
+		important := importantPattern.MatchString(value)
+		if important {
+			value = importantPattern.ReplaceAllString(value, "")
+		}
+
+		declarations = append(declarations, &cssDeclaration{property: property, value: value, important: important})
+	}
+
+	return declarations
+}
+
+// indexOutside returns the index of the first character in `s`, starting at
+// `from`, that is one of `chars` and isn't inside a quoted string or
+// parentheses. It returns `len(s)` if there is no such character.
+func indexOutside(s string, from int, chars string) int {
+	var quote byte
+	depth := 0
+	for i := from; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case depth == 0 && strings.IndexByte(chars, c) >= 0:
+			return i
+		}
+	}
+
+	return len(s)
+}
+
+// matchingBrace returns the index of the brace that closes the block opening at
+// `open`, or `len(s)` if the block isn't closed.
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i = indexOutside(s, i+1, "{}") {
+		if s[i] == '{' {
+			depth++
+		} else if depth--; depth == 0 {
+			return i
+		}
+	}
+
+	return len(s)
+}
+
+// splitOutside splits `s` at the given separator, ignoring the separators
+// inside quoted strings and parentheses.
+func splitOutside(s string, sep byte) []string {
+	parts := []string{}
+	for i := 0; i <= len(s); {
+		end := indexOutside(s, i, string(sep))
+		parts = append(parts, s[i:end])
+		i = end + 1
+	}
+
+	return parts
+}
+
+// inlineStyle is an ordered set of the css declarations for a style attribute.
+type inlineStyle struct {
+	properties   []string
+	declarations map[string]*cssDeclaration
+}
+
+func newInlineStyle() *inlineStyle {
+	return &inlineStyle{declarations: map[string]*cssDeclaration{}}
+}
+
+// set overrides the existing declarations with the given ones, unless the
+// existing declarations are important and the given ones aren't.
+func (s *inlineStyle) set(declarations []*cssDeclaration) {
+	for _, d := range declarations {
+		existing, ok := s.declarations[d.property]
+		if !ok {
+			s.properties = append(s.properties, d.property)
+		} else if existing.important && !d.important {
+			continue
+		}
+
+		s.declarations[d.property] = d
+	}
+}
+
+func (s *inlineStyle) String() string {
+	declarations := make([]string, 0, len(s.properties))
+	for _, p := range s.properties {
+		d := s.declarations[p]
+		if d.important {
+			declarations = append(declarations, p+": "+d.value+" !important")
+		} else {
+			declarations = append(declarations, p+": "+d.value)
+		}
+	}
+
+	return strings.Join(declarations, "; ")
+}
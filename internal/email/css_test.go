@@ -0,0 +1,62 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInlineStyles(t *testing.T) {
+	t.Run("WithoutStyles", func(t *testing.T) {
+		const source = `<p>test</p>`
+		got, err := inlineStyles(source)
+		require.NoError(t, err)
+		assert.Equal(t, source, got)
+	})
+
+	t.Run("WithStyles", func(t *testing.T) {
+		const source = `<!doctype html>
+<html>
+<head>
+<style>
+/* comment { color: black; } */
+p { color: red; margin: 0 }
+.note, #first { color: green; font-family: "A;B", sans-serif; }
+p.note { color: blue !important; background: url("data:image/png;base64,AAA=") }
+a:hover { color: orange }
+@media (max-width: 600px) { p { margin: 8px; } }
+@import url("fonts.css");
+</style>
+</head>
+<body>
+<p id="first" style="color: black; padding: 4px">one</p>
+<p class="note" style="color: black">two</p>
+<a href="#">three</a>
+</body>
+</html>`
+
+		got, err := inlineStyles(source)
+		require.NoError(t, err)
+		assert.Contains(t, got, `<p id="first" style="color: black; margin: 0; font-family: &#34;A;B&#34;, sans-serif; padding: 4px">one</p>`)
+		assert.Contains(t, got, `<p class="note" style="color: blue !important; margin: 0; font-family: &#34;A;B&#34;, sans-serif; background: url(&#34;data:image/png;base64,AAA=&#34;)">two</p>`)
+		assert.Contains(t, got, `<a href="#">three</a>`)
+		assert.Contains(t, got, `<style>@import url("fonts.css");`+"\n@media (max-width: 600px) { p { margin: 8px; } }\na:hover { color: orange }</style></head>")
+		assert.NotContains(t, got, "comment")
+	})
+
+	t.Run("WithUnclosedBlocks", func(t *testing.T) {
+		got, err := inlineStyles(`<html><head><style>p {</style></head><body><p>one</p></body></html>`)
+		require.NoError(t, err)
+		assert.Contains(t, got, "<p>one</p>")
+
+		got, err = inlineStyles(`<html><head><style>p { color: red; } a { color: blue</style></head><body><p>one</p><a>two</a></body></html>`)
+		require.NoError(t, err)
+		assert.Contains(t, got, `<p style="color: red">one</p>`)
+		assert.Contains(t, got, `<a style="color: blue">two</a>`)
+
+		got, err = inlineStyles(`<html><head><style>@media print { p { margin: 0 }</style></head><body><p>one</p></body></html>`)
+		require.NoError(t, err)
+		assert.Contains(t, got, "<style>@media print { p { margin: 0 }</style>")
+	})
+}
@@ -6,19 +6,56 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"unicode/utf8"
+
+	"github.com/trynoice/iris/internal/config"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
 )
 
-func NewDataReader(dir string, defaultFileName string, dataFileName string) (*DataReader, error) {
+const (
+	DataFormatCsv   = "csv"
+	DataFormatJson  = "json"
+	DataFormatJsonl = "jsonl"
+
+	RecipientSourceSqlite = "sqlite"
+
+	// StdinDataFile is the name of the recipient data file that reads the
+	// recipient data from the standard input.
+	StdinDataFile = "-"
+)
+
+// DataReader reads the recipient data row by row. Each row is a
+// map[string]string for the csv data, or a map[string]any with the structured
+// values for the json and sqlite data.
+type DataReader interface {
+	Read() (any, error)
+	Close() error
+}
+
+// NewDataReader opens the recipient data file in the given format, or the
+// format inferred from its extension if `cfg.RecipientDataFormat` is empty. It
+// reads the recipient data from `stdin` if the file name is `-`, or from
+// `cfg.RecipientSource` if it is set. The values in the default csv file fill
+// the missing or empty values in each row.
+func NewDataReader(dir string, cfg *config.MessageConfig, stdin io.Reader) (DataReader, error) {
 	defaultValues := map[string]string{}
-	if defaultFileName != "" {
-		file, err := os.Open(filepath.Join(dir, defaultFileName))
+	if cfg.DefaultDataCsvFile != "" {
+		file, err := os.Open(filepath.Join(dir, cfg.DefaultDataCsvFile))
 		if err != nil {
 			return nil, fmt.Errorf("failed to open default csv: %w", err)
 		}
 
 		defer file.Close()
-		rows, err := csv.NewReader(file).ReadAll()
+		reader, err := newCsvReader(file, &cfg.Csv)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := reader.ReadAll()
 		if err != nil {
 			return nil, fmt.Errorf("failed to read records from default csv: %w", err)
 		}
@@ -32,21 +69,77 @@ func NewDataReader(dir string, defaultFileName string, dataFileName string) (*Da
 		}
 	}
 
-	dataFile, err := os.Open(filepath.Join(dir, dataFileName))
+	if src := cfg.RecipientSource; src != nil {
+		switch src.Type {
+		case RecipientSourceSqlite:
+			return newSqliteDataReader(dir, src, defaultValues)
+		}
+
+		return nil, fmt.Errorf("unsupported recipient source %q", src.Type)
+	}
+
+	format := cfg.RecipientDataFormat
+	if format == "" {
+		format = dataFormat(cfg.RecipientDataCsvFile)
+	}
+
+	if format != DataFormatCsv && format != DataFormatJson && format != DataFormatJsonl {
+		return nil, fmt.Errorf("unsupported recipient data format %q", format)
+	}
+
+	var dataFile io.ReadCloser
+	if cfg.RecipientDataCsvFile == StdinDataFile {
+		if stdin == nil {
+			return nil, fmt.Errorf("standard input isn't available for reading the recipient data")
+		}
+
+		dataFile = io.NopCloser(stdin)
+	} else {
+		f, err := os.Open(filepath.Join(dir, cfg.RecipientDataCsvFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open recipient data: %w", err)
+		}
+
+		dataFile = f
+	}
+
+	if format == DataFormatCsv {
+		return newCsvDataReader(dataFile, &cfg.Csv, defaultValues)
+	}
+
+	return newJsonDataReader(dataFile, format == DataFormatJsonl, defaultValues)
+}
+
+// dataFormat infers the format of the recipient data from the extension of its
+// file, defaulting to csv.
+func dataFormat(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return DataFormatJson
+	case ".jsonl", ".ndjson":
+		return DataFormatJsonl
+	}
+
+	return DataFormatCsv
+}
+
+func newCsvDataReader(dataFile io.ReadCloser, csvCfg *config.CsvConfig, defaultValues map[string]string) (DataReader, error) {
+	reader, err := newCsvReader(dataFile, csvCfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open data csv: %w", err)
+		dataFile.Close()
+		return nil, err
 	}
 
-	reader := csv.NewReader(dataFile)
 	reader.ReuseRecord = true
 	row, err := reader.Read()
 	if err != nil {
+		dataFile.Close()
 		return nil, fmt.Errorf("failed to read headers from data csv: %w", err)
 	}
 
 	headers := make([]string, len(row))
 	copy(headers, row)
-	return &DataReader{
+	return &csvDataReader{
 		mutex:         sync.Mutex{},
 		defaultValues: defaultValues,
 		fileCloser:    dataFile,
@@ -55,7 +148,7 @@ func NewDataReader(dir string, defaultFileName string, dataFileName string) (*Da
 	}, nil
 }
 
-type DataReader struct {
+type csvDataReader struct {
 	mutex         sync.Mutex
 	defaultValues map[string]string
 	fileCloser    io.Closer
@@ -63,7 +156,7 @@ type DataReader struct {
 	headers       []string
 }
 
-func (r *DataReader) Read() (map[string]string, error) {
+func (r *csvDataReader) Read() (any, error) {
 	// needs mutex because a shared buffer is used for sequentially reading csv
 	// records. although never invoked in parallel, it is still a good practice.
 	r.mutex.Lock()
@@ -86,10 +179,45 @@ func (r *DataReader) Read() (map[string]string, error) {
 	return row, nil
 }
 
-func (r *DataReader) Close() error {
+func (r *csvDataReader) Close() error {
 	return r.fileCloser.Close()
 }
 
+// newCsvReader returns a csv reader for the given dialect. It decodes the input
+// from the given encoding, or UTF-8 by default, and strips the byte order mark.
+func newCsvReader(r io.Reader, cfg *config.CsvConfig) (*csv.Reader, error) {
+	var decoder transform.Transformer = transform.Nop
+	if cfg.Encoding != "" {
+		enc, err := htmlindex.Get(cfg.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported csv encoding %q", cfg.Encoding)
+		}
+
+		decoder = enc.NewDecoder()
+	}
+
+	reader := csv.NewReader(transform.NewReader(r, unicode.BOMOverride(decoder)))
+	reader.LazyQuotes = cfg.LazyQuotes
+	reader.TrimLeadingSpace = cfg.TrimLeadingSpace
+	if cfg.Delimiter != "" {
+		if utf8.RuneCountInString(cfg.Delimiter) != 1 {
+			return nil, fmt.Errorf("csv delimiter must be a single character")
+		}
+
+		reader.Comma, _ = utf8.DecodeRuneInString(cfg.Delimiter)
+	}
+
+	if cfg.Comment != "" {
+		if utf8.RuneCountInString(cfg.Comment) != 1 {
+			return nil, fmt.Errorf("csv comment must be a single character")
+		}
+
+		reader.Comment, _ = utf8.DecodeRuneInString(cfg.Comment)
+	}
+
+	return reader, nil
+}
+
 func buildMap(keys []string, values []string) map[string]string {
 	data := map[string]string{}
 	for i, key := range keys {
@@ -97,3 +225,32 @@ func buildMap(keys []string, values []string) map[string]string {
 	}
 	return data
 }
+
+// LookupValue returns the value for the given key in a row of recipient data.
+func LookupValue(data any, key string) (any, bool) {
+	switch data := data.(type) {
+	case map[string]string:
+		v, ok := data[key]
+		return v, ok
+	case map[string]any:
+		v, ok := data[key]
+		return v, ok
+	}
+
+	return nil, false
+}
+
+// StringValue returns the string value for the given key in a row of recipient
+// data. It formats numbers and booleans, and returns an empty string for the
+// missing, null, array and object values.
+func StringValue(data any, key string) string {
+	v, _ := LookupValue(data, key)
+	switch v := v.(type) {
+	case nil, []any, map[string]any:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
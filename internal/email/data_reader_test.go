@@ -1,10 +1,15 @@
 package email_test
 
 import (
+	"database/sql"
 	"io"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trynoice/iris/internal/config"
 	"github.com/trynoice/iris/internal/email"
 	"github.com/trynoice/iris/internal/testutil"
 )
@@ -19,7 +24,7 @@ func TestDataReader(t *testing.T) {
 		tmpDir := t.TempDir()
 		testutil.CreateFile(t, tmpDir, defaultFile, defaultFileContent)
 
-		r, err := email.NewDataReader(tmpDir, defaultFile, dataFile)
+		r, err := email.NewDataReader(tmpDir, &config.MessageConfig{DefaultDataCsvFile: defaultFile, RecipientDataCsvFile: dataFile}, nil)
 		assert.Error(t, err)
 		assert.Nil(t, r)
 	})
@@ -28,7 +33,7 @@ func TestDataReader(t *testing.T) {
 		tmpDir := t.TempDir()
 		testutil.CreateFile(t, tmpDir, dataFile, dataFileContent)
 
-		r, err := email.NewDataReader(tmpDir, defaultFile, dataFile)
+		r, err := email.NewDataReader(tmpDir, &config.MessageConfig{DefaultDataCsvFile: defaultFile, RecipientDataCsvFile: dataFile}, nil)
 		assert.Error(t, err)
 		assert.Nil(t, r)
 	})
@@ -38,21 +43,21 @@ func TestDataReader(t *testing.T) {
 		testutil.CreateFile(t, tmpDir, defaultFile, defaultFileContent)
 		testutil.CreateFile(t, tmpDir, dataFile, dataFileContent)
 
-		r, err := email.NewDataReader(tmpDir, "", dataFile)
+		r, err := email.NewDataReader(tmpDir, &config.MessageConfig{RecipientDataCsvFile: dataFile}, nil)
 		assert.NoError(t, err)
 		assert.NotNil(t, r)
 
 		record, err := r.Read()
 		assert.NoError(t, err)
-		assert.Empty(t, record["col1"])
-		assert.Equal(t, "ghi", record["col2"])
-		assert.Equal(t, "jkl", record["col3"])
+		assert.Empty(t, email.StringValue(record, "col1"))
+		assert.Equal(t, "ghi", email.StringValue(record, "col2"))
+		assert.Equal(t, "jkl", email.StringValue(record, "col3"))
 
 		record, err = r.Read()
 		assert.NoError(t, err)
-		assert.Empty(t, record["col1"])
-		assert.Equal(t, "mno", record["col2"])
-		assert.Equal(t, "pqr", record["col3"])
+		assert.Empty(t, email.StringValue(record, "col1"))
+		assert.Equal(t, "mno", email.StringValue(record, "col2"))
+		assert.Equal(t, "pqr", email.StringValue(record, "col3"))
 
 		_, err = r.Read()
 		assert.ErrorIs(t, err, io.EOF)
@@ -63,23 +68,248 @@ func TestDataReader(t *testing.T) {
 		testutil.CreateFile(t, tmpDir, defaultFile, defaultFileContent)
 		testutil.CreateFile(t, tmpDir, dataFile, dataFileContent)
 
-		r, err := email.NewDataReader(tmpDir, defaultFile, dataFile)
+		r, err := email.NewDataReader(tmpDir, &config.MessageConfig{DefaultDataCsvFile: defaultFile, RecipientDataCsvFile: dataFile}, nil)
 		assert.NoError(t, err)
 		assert.NotNil(t, r)
 
 		record, err := r.Read()
 		assert.NoError(t, err)
-		assert.Equal(t, "abc", record["col1"])
-		assert.Equal(t, "ghi", record["col2"])
-		assert.Equal(t, "jkl", record["col3"])
+		assert.Equal(t, "abc", email.StringValue(record, "col1"))
+		assert.Equal(t, "ghi", email.StringValue(record, "col2"))
+		assert.Equal(t, "jkl", email.StringValue(record, "col3"))
 
 		record, err = r.Read()
 		assert.NoError(t, err)
-		assert.Equal(t, "abc", record["col1"])
-		assert.Equal(t, "mno", record["col2"])
-		assert.Equal(t, "pqr", record["col3"])
+		assert.Equal(t, "abc", email.StringValue(record, "col1"))
+		assert.Equal(t, "mno", email.StringValue(record, "col2"))
+		assert.Equal(t, "pqr", email.StringValue(record, "col3"))
 
 		_, err = r.Read()
 		assert.ErrorIs(t, err, io.EOF)
 	})
+	t.Run("WithCsvDialect", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, defaultFile, "\xef\xbb\xbfcol1; col4\n# comment\nabc; d\"ef")
+		testutil.CreateFile(t, tmpDir, dataFile, "Email;col2\n# comment\nabc@iris.test; caf\xe9")
+
+		cfg := &config.MessageConfig{
+			DefaultDataCsvFile:   defaultFile,
+			RecipientDataCsvFile: dataFile,
+			Csv: config.CsvConfig{
+				Delimiter:        ";",
+				Comment:          "#",
+				LazyQuotes:       true,
+				TrimLeadingSpace: true,
+				Encoding:         "windows-1252",
+			},
+		}
+
+		r, err := email.NewDataReader(tmpDir, cfg, nil)
+		require.NoError(t, err)
+
+		record, err := r.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"Email": "abc@iris.test",
+			"col1":  "abc",
+			"col2":  "café",
+			"col4":  "d\"ef",
+		}, record)
+
+		_, err = r.Read()
+		assert.ErrorIs(t, err, io.EOF)
+		assert.NoError(t, r.Close())
+	})
+
+	t.Run("WithUtf8Bom", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, dataFile, "\xef\xbb\xbfEmail\nabc@iris.test")
+
+		r, err := email.NewDataReader(tmpDir, &config.MessageConfig{RecipientDataCsvFile: dataFile}, nil)
+		require.NoError(t, err)
+
+		record, err := r.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"Email": "abc@iris.test"}, record)
+	})
+
+	t.Run("WithInvalidCsvDialect", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, dataFile, dataFileContent)
+
+		for _, csvCfg := range []config.CsvConfig{
+			{Delimiter: ";;"},
+			{Comment: "//"},
+			{Encoding: "klingon"},
+		} {
+			r, err := email.NewDataReader(tmpDir, &config.MessageConfig{RecipientDataCsvFile: dataFile, Csv: csvCfg}, nil)
+			assert.Error(t, err)
+			assert.Nil(t, r)
+		}
+	})
+
+	t.Run("WithJsonDataFile", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, defaultFile, defaultFileContent)
+		testutil.CreateFile(t, tmpDir, "data.json", `[
+			{"col1": "", "col2": "ghi", "items": [{"name": "a", "qty": 2}], "total": 9.5, "paid": true},
+			{"col2": "mno", "col3": null}
+		]`)
+
+		r, err := email.NewDataReader(tmpDir, &config.MessageConfig{DefaultDataCsvFile: defaultFile, RecipientDataCsvFile: "data.json"}, nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, r)
+
+		record, err := r.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{
+			"col1":  "abc",
+			"col2":  "ghi",
+			"items": []any{map[string]any{"name": "a", "qty": int64(2)}},
+			"total": 9.5,
+			"paid":  true,
+		}, record)
+
+		record, err = r.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"col1": "abc", "col2": "mno", "col3": nil}, record)
+
+		_, err = r.Read()
+		assert.ErrorIs(t, err, io.EOF)
+		_, err = r.Read()
+		assert.ErrorIs(t, err, io.EOF)
+		assert.NoError(t, r.Close())
+	})
+
+	t.Run("WithJsonLinesDataFile", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, "data.txt", "{\"col2\": \"ghi\", \"n\": 12345678901234567}\n\n{\"col2\": \"mno\"}\n")
+
+		r, err := email.NewDataReader(tmpDir, &config.MessageConfig{RecipientDataCsvFile: "data.txt", RecipientDataFormat: "jsonl"}, nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, r)
+
+		record, err := r.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"col2": "ghi", "n": int64(12345678901234567)}, record)
+
+		record, err = r.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"col2": "mno"}, record)
+
+		_, err = r.Read()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("WithInvalidJsonData", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, "object.json", `{"col2": "ghi"}`)
+		testutil.CreateFile(t, tmpDir, "array.jsonl", `["ghi"]`)
+
+		r, err := email.NewDataReader(tmpDir, &config.MessageConfig{RecipientDataCsvFile: "object.json"}, nil)
+		assert.Error(t, err)
+		assert.Nil(t, r)
+
+		r, err = email.NewDataReader(tmpDir, &config.MessageConfig{RecipientDataCsvFile: "array.jsonl"}, nil)
+		assert.NoError(t, err)
+		_, err = r.Read()
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("WithStdin", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, defaultFile, defaultFileContent)
+		cfg := &config.MessageConfig{DefaultDataCsvFile: defaultFile, RecipientDataCsvFile: "-", RecipientDataFormat: "jsonl"}
+
+		r, err := email.NewDataReader(tmpDir, cfg, strings.NewReader(`{"col2": "ghi"}`))
+		assert.NoError(t, err)
+
+		record, err := r.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"col1": "abc", "col2": "ghi"}, record)
+
+		_, err = r.Read()
+		assert.ErrorIs(t, err, io.EOF)
+		assert.NoError(t, r.Close())
+
+		r, err = email.NewDataReader(tmpDir, cfg, nil)
+		assert.Error(t, err)
+		assert.Nil(t, r)
+	})
+
+	t.Run("WithUnknownDataFormat", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, dataFile, dataFileContent)
+
+		r, err := email.NewDataReader(tmpDir, &config.MessageConfig{RecipientDataCsvFile: dataFile, RecipientDataFormat: "xml"}, nil)
+		assert.Error(t, err)
+		assert.Nil(t, r)
+	})
+	t.Run("WithSqliteSource", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, defaultFile, defaultFileContent)
+
+		db, err := sql.Open("sqlite", filepath.Join(tmpDir, "app.db"))
+		require.NoError(t, err)
+		_, err = db.Exec(`CREATE TABLE users (email TEXT, col1 TEXT, age INTEGER, score REAL);
+			INSERT INTO users VALUES ('abc@iris.test', NULL, 30, 1.5), ('def@iris.test', 'ghi', NULL, NULL);`)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		cfg := &config.MessageConfig{
+			DefaultDataCsvFile: defaultFile,
+			RecipientSource: &config.RecipientSourceConfig{
+				Type:     "sqlite",
+				Database: "app.db",
+				Query:    "SELECT email AS Email, col1, age, score FROM users ORDER BY email",
+			},
+		}
+
+		r, err := email.NewDataReader(tmpDir, cfg, nil)
+		require.NoError(t, err)
+
+		record, err := r.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{
+			"Email": "abc@iris.test",
+			"col1":  "abc",
+			"col2":  "def",
+			"age":   int64(30),
+			"score": 1.5,
+		}, record)
+
+		record, err = r.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{
+			"Email": "def@iris.test",
+			"col1":  "ghi",
+			"col2":  "def",
+			"age":   "",
+			"score": "",
+		}, record)
+
+		_, err = r.Read()
+		assert.ErrorIs(t, err, io.EOF)
+		assert.NoError(t, r.Close())
+
+		cfg.RecipientSource.Query = "SELECT * FROM missing"
+		r, err = email.NewDataReader(tmpDir, cfg, nil)
+		assert.Error(t, err)
+		assert.Nil(t, r)
+
+		cfg.RecipientSource.Database = "missing.db"
+		r, err = email.NewDataReader(tmpDir, cfg, nil)
+		assert.Error(t, err)
+		assert.Nil(t, r)
+		assert.NoFileExists(t, filepath.Join(tmpDir, "missing.db"))
+	})
+
+	t.Run("WithUnknownSource", func(t *testing.T) {
+		r, err := email.NewDataReader(t.TempDir(), &config.MessageConfig{
+			RecipientSource: &config.RecipientSourceConfig{Type: "postgres"},
+		}, nil)
+		assert.Error(t, err)
+		assert.Nil(t, r)
+	})
 }
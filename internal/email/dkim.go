@@ -0,0 +1,83 @@
+package email
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/toorop/go-dkim"
+	"github.com/trynoice/iris/internal/config"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// defaultDkimHeaders are the headers that are signed if the DKIM config doesn't
+// specify them.
+var defaultDkimHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID",
+	"MIME-Version", "Content-Type", "List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// NewDkimSmtpClient wraps the given client to sign each email with the given
+// PEM-encoded RSA private key before sending it.
+func NewDkimSmtpClient(client SmtpClient, cfg *config.DkimConfig, privateKey []byte) (SmtpClient, error) {
+	if cfg.Domain == "" || cfg.Selector == "" {
+		return nil, fmt.Errorf("dkim domain and selector must not be empty")
+	}
+
+	// go-dkim only reports a generic error for invalid keys, so validate the key
+	// beforehand to provide a more useful error.
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode dkim private key: not in pem format")
+	}
+
+	if _, err := x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse dkim private key: %w", err)
+		}
+
+		// go-dkim only signs with rsa keys, and panics with the other keys.
+		if _, ok := key.(*rsa.PrivateKey); !ok {
+			return nil, fmt.Errorf("failed to parse dkim private key: %T is not an rsa key", key)
+		}
+	}
+
+	opts := dkim.NewSigOptions()
+	opts.PrivateKey = privateKey
+	opts.Domain = cfg.Domain
+	opts.Selector = cfg.Selector
+	opts.Canonicalization = "relaxed/relaxed"
+	opts.Headers = defaultDkimHeaders
+	if cfg.Canonicalization != "" {
+		opts.Canonicalization = cfg.Canonicalization
+	}
+
+	if len(cfg.Headers) > 0 {
+		opts.Headers = cfg.Headers
+	}
+
+	return &dkimSmtpClient{upstream: client, opts: opts}, nil
+}
+
+type dkimSmtpClient struct {
+	upstream SmtpClient
+	opts     dkim.SigOptions
+}
+
+func (c *dkimSmtpClient) SendEmail(email *mail.Email) error {
+	// dkim.Sign normalises the header names in-place, so each email needs its
+	// own copy to sign concurrently.
+	opts := c.opts
+	opts.Headers = append([]string{}, c.opts.Headers...)
+	if err := email.SetDkim(opts).GetError(); err != nil {
+		return permanent(fmt.Errorf("failed to sign email: %w", err))
+	}
+
+	return c.upstream.SendEmail(email)
+}
+
+func (c *dkimSmtpClient) Close() error {
+	return c.upstream.Close()
+}
@@ -0,0 +1,90 @@
+package email_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toorop/go-dkim"
+	"github.com/trynoice/iris/internal/config"
+	"github.com/trynoice/iris/internal/email"
+)
+
+func TestDkimSmtpClient(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	cfg := &config.DkimConfig{
+		Selector: "test",
+		Domain:   "iris.test",
+	}
+
+	t.Run("WithValidKey", func(t *testing.T) {
+		for _, canonicalization := range []string{"", "simple/simple", "relaxed/simple"} {
+			c := &FakeSmtpClient{}
+			cfg := *cfg
+			cfg.Canonicalization = canonicalization
+			signer, err := email.NewDkimSmtpClient(c, &cfg, privateKey)
+			require.NoError(t, err)
+
+			s := email.NewSmtpServiceWithClient(signer)
+			_, err = s.Send(&email.SendOptions{
+				From: "from@iris.test",
+				To:   []string{"to@iris.test"},
+				Message: &email.Message{
+					Subject:  "test-subject",
+					TextBody: "test-text-body",
+					HtmlBody: "<p>test-html-body</p>",
+					Headers: map[string]string{
+						"List-Unsubscribe": "<https://iris.test/unsubscribe>",
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			msg := []byte(c.LastSentEmail.DkimMsg)
+			require.NotEmpty(t, msg)
+			status, err := dkim.Verify(&msg, dkim.DNSOptLookupTXT(func(name string) ([]string, error) {
+				assert.Equal(t, "test._domainkey.iris.test", name)
+				return []string{"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(publicKey)}, nil
+			}))
+			assert.NoError(t, err)
+			assert.Equal(t, dkim.SUCCESS, status)
+		}
+	})
+
+	t.Run("WithInvalidKey", func(t *testing.T) {
+		signer, err := email.NewDkimSmtpClient(&FakeSmtpClient{}, cfg, []byte("test-key"))
+		assert.Error(t, err)
+		assert.Nil(t, signer)
+	})
+
+	t.Run("WithNonRsaKey", func(t *testing.T) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+
+		privateKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		signer, err := email.NewDkimSmtpClient(&FakeSmtpClient{}, cfg, privateKey)
+		assert.ErrorContains(t, err, "not an rsa key")
+		assert.Nil(t, signer)
+	})
+
+	t.Run("WithoutSelector", func(t *testing.T) {
+		signer, err := email.NewDkimSmtpClient(&FakeSmtpClient{}, &config.DkimConfig{Domain: "iris.test"}, privateKey)
+		assert.Error(t, err)
+		assert.Nil(t, signer)
+	})
+}
@@ -0,0 +1,46 @@
+package email
+
+import (
+	"fmt"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Filter selects the recipients whose data matches an expression, e.g.
+// `Plan == "pro" && Country in ["DE", "AT"]`. See https://expr-lang.org for the
+// expression syntax.
+type Filter struct {
+	program *vm.Program
+}
+
+func NewFilter(expression string) (*Filter, error) {
+	program, err := expr.Compile(expression, expr.AsBool(), expr.AllowUndefinedVariables())
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+
+	return &Filter{program: program}, nil
+}
+
+// Match reports whether the given row of recipient data matches the filter.
+// Keys missing from the row evaluate to nil.
+func (f *Filter) Match(data any) (bool, error) {
+	env := map[string]any{}
+	switch data := data.(type) {
+	case map[string]string:
+		for k, v := range data {
+			env[k] = v
+		}
+	case map[string]any:
+		env = data
+	}
+
+	result, err := expr.Run(f.program, env)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate filter: %w", err)
+	}
+
+	matches, ok := result.(bool)
+	return ok && matches, nil
+}
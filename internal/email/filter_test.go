@@ -0,0 +1,62 @@
+package email_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trynoice/iris/internal/email"
+)
+
+func TestFilter(t *testing.T) {
+	t.Run("WithCsvData", func(t *testing.T) {
+		f, err := email.NewFilter(`Plan == "pro" && Country in ["DE", "AT"]`)
+		require.NoError(t, err)
+
+		for _, test := range []struct {
+			data map[string]string
+			want bool
+		}{
+			{data: map[string]string{"Plan": "pro", "Country": "DE"}, want: true},
+			{data: map[string]string{"Plan": "pro", "Country": "AT"}, want: true},
+			{data: map[string]string{"Plan": "pro", "Country": "FR"}, want: false},
+			{data: map[string]string{"Plan": "free", "Country": "DE"}, want: false},
+			{data: map[string]string{"Country": "DE"}, want: false},
+		} {
+			got, err := f.Match(test.data)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got, test.data)
+		}
+	})
+
+	t.Run("WithJsonData", func(t *testing.T) {
+		f, err := email.NewFilter(`Age >= 18 && len(Orders) > 0 && $env["First Name"] != ""`)
+		require.NoError(t, err)
+
+		got, err := f.Match(map[string]any{"Age": int64(30), "Orders": []any{"a"}, "First Name": "Jack"})
+		assert.NoError(t, err)
+		assert.True(t, got)
+
+		got, err = f.Match(map[string]any{"Age": int64(16), "Orders": []any{"a"}, "First Name": "Jill"})
+		assert.NoError(t, err)
+		assert.False(t, got)
+	})
+
+	t.Run("WithInvalidExpression", func(t *testing.T) {
+		f, err := email.NewFilter(`Plan ==`)
+		assert.Error(t, err)
+		assert.Nil(t, f)
+
+		f, err = email.NewFilter(`"pro"`)
+		assert.Error(t, err)
+		assert.Nil(t, f)
+	})
+
+	t.Run("WithEvaluationError", func(t *testing.T) {
+		f, err := email.NewFilter(`int(Age) > 30`)
+		require.NoError(t, err)
+
+		_, err = f.Match(map[string]string{"Age": "abc"})
+		assert.Error(t, err)
+	})
+}
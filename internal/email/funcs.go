@@ -0,0 +1,227 @@
+package email
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// dateLayouts are the layouts that the `date` template function tries, in
+// order, to parse the dates given as strings.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// templateFuncs returns the functions available to all email templates in
+// addition to the Go's built-in template functions. Their names and argument
+// order follow Sprig (https://masterminds.github.io/sprig), so that the values
+// can be piped as the last argument, e.g. `{{ .Name | default "there" }}`.
+func templateFuncs() map[string]any {
+	return map[string]any{
+		"upper":        strings.ToUpper,
+		"lower":        strings.ToLower,
+		"title":        title,
+		"trim":         strings.TrimSpace,
+		"trunc":        trunc,
+		"default":      defaultValue,
+		"empty":        empty,
+		"coalesce":     coalesce,
+		"ternary":      ternary,
+		"now":          time.Now,
+		"toDate":       toDate,
+		"date":         date,
+		"formatNumber": formatNumber,
+		"currency":     currency,
+		"toJson":       toJson,
+	}
+}
+
+// title capitalises the first letter of each word in the given string.
+func title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		isWordStart := !unicode.IsLetter(prev) && !unicode.IsDigit(prev) && prev != '_'
+		prev = r
+		if isWordStart {
+			return unicode.ToTitle(r)
+		}
+
+		return r
+	}, s)
+}
+
+// trunc truncates the given string to the given number of characters. A
+// negative length keeps the last characters instead.
+func trunc(length int, s string) string {
+	runes := []rune(s)
+	if length < 0 && -length < len(runes) {
+		return string(runes[len(runes)+length:])
+	} else if length >= 0 && length < len(runes) {
+		return string(runes[:length])
+	}
+
+	return s
+}
+
+// defaultValue returns the given value, or `d` if the value is missing or
+// empty.
+func defaultValue(d any, given ...any) any {
+	if len(given) == 0 || empty(given[0]) {
+		return d
+	}
+
+	return given[0]
+}
+
+// empty reports whether the given value is nil, false, zero or has zero length.
+func empty(v any) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Interface, reflect.Pointer:
+		return rv.IsNil()
+	}
+
+	return rv.IsZero()
+}
+
+// coalesce returns the first non-empty value.
+func coalesce(v ...any) any {
+	for _, e := range v {
+		if !empty(e) {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// ternary returns `vt` if `cond` is true, and `vf` otherwise.
+func ternary(vt any, vf any, cond bool) any {
+	if cond {
+		return vt
+	}
+
+	return vf
+}
+
+// toDate parses the given string as a date using the given layout.
+func toDate(layout string, value string) (time.Time, error) {
+	return time.Parse(layout, strings.TrimSpace(value))
+}
+
+// date formats the given date using the given layout. The date can be a
+// `time.Time`, a unix timestamp or a string in one of the `dateLayouts`.
+func date(layout string, value any) (string, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(layout), nil
+	case int:
+		return time.Unix(int64(v), 0).UTC().Format(layout), nil
+	case int64:
+		return time.Unix(v, 0).UTC().Format(layout), nil
+	case float64:
+		return time.Unix(int64(v), 0).UTC().Format(layout), nil
+	case string:
+		for _, l := range dateLayouts {
+			if t, err := time.Parse(l, strings.TrimSpace(v)); err == nil {
+				return t.Format(layout), nil
+			}
+		}
+
+		return "", fmt.Errorf("failed to parse date %q", v)
+	}
+
+	return "", fmt.Errorf("unsupported date type %T", value)
+}
+
+// formatNumber formats the given number with the given number of decimals and
+// comma separated thousands, e.g. `1,234.50`.
+func formatNumber(decimals int, value any) (string, error) {
+	f, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+
+	s := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+	integer, fraction, hasFraction := strings.Cut(s, ".")
+	b := strings.Builder{}
+	if f < 0 {
+		b.WriteByte('-')
+	}
+
+	for i, r := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+
+		b.WriteRune(r)
+	}
+
+	if hasFraction {
+		b.WriteByte('.')
+		b.WriteString(fraction)
+	}
+
+	return b.String(), nil
+}
+
+// currency formats the given amount with two decimals, prefixed with the given
+// currency symbol, e.g. `$1,234.50`.
+func currency(symbol string, value any) (string, error) {
+	s, err := formatNumber(2, value)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(s, "-") {
+		return "-" + symbol + s[1:], nil
+	}
+
+	return symbol + s, nil
+}
+
+// toJson encodes the given value as JSON.
+func toJson(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode json: %w", err)
+	}
+
+	return string(data), nil
+}
+
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse number %q", v)
+		}
+
+		return f, nil
+	}
+
+	return 0, fmt.Errorf("unsupported number type %T", value)
+}
@@ -0,0 +1,66 @@
+package email
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	data := map[string]any{
+		"name":    "jack o'neil",
+		"padded":  "  padded  ",
+		"empty":   "",
+		"date":    "2024-01-15",
+		"amount":  "-1234567.891",
+		"count":   "1234",
+		"tags":    []string{"a", "b"},
+		"invalid": "abc",
+	}
+
+	for _, test := range []struct {
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{template: `{{ .name | upper }}`, want: "JACK O'NEIL"},
+		{template: `{{ "ABC" | lower }}`, want: "abc"},
+		{template: `{{ .name | title }}`, want: "Jack O'Neil"},
+		{template: `[{{ .padded | trim }}]`, want: "[padded]"},
+		{template: `{{ .name | trunc 4 }}`, want: "jack"},
+		{template: `{{ .name | trunc -5 }}`, want: "'neil"},
+		{template: `{{ .name | trunc 50 }}`, want: "jack o'neil"},
+		{template: `{{ .empty | default "there" }}`, want: "there"},
+		{template: `{{ .name | default "there" }}`, want: "jack o'neil"},
+		{template: `{{ .missing | default "there" }}`, want: "there"},
+		{template: `{{ if empty .empty }}empty{{ end }}`, want: "empty"},
+		{template: `{{ coalesce .empty .missing .name }}`, want: "jack o'neil"},
+		{template: `{{ empty .empty | ternary "yes" "no" }}`, want: "yes"},
+		{template: `{{ .date | date "Jan 2, 2006" }}`, want: "Jan 15, 2024"},
+		{template: `{{ toDate "02/01/2006" "15/01/2024" | date "2006-01-02" }}`, want: "2024-01-15"},
+		{template: `{{ .invalid | date "2006" }}`, wantErr: true},
+		{template: `{{ .count | formatNumber 0 }}`, want: "1,234"},
+		{template: `{{ .amount | formatNumber 1 }}`, want: "-1,234,567.9"},
+		{template: `{{ .amount | currency "$" }}`, want: "-$1,234,567.89"},
+		{template: `{{ .invalid | currency "$" }}`, wantErr: true},
+		{template: `{{ .tags | toJson }}`, want: `["a","b"]`},
+		{template: `{{ .name | urlquery }}`, want: "jack+o%27neil"},
+	} {
+		t.Run(test.template, func(t *testing.T) {
+			tmpl, err := template.New("").Funcs(templateFuncs()).Parse(test.template)
+			require.NoError(t, err)
+
+			b := &bytes.Buffer{}
+			err = tmpl.Execute(b, data)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.want, b.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package email
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	journalDir  = ".iris-state"
+	journalFile = "journal.jsonl"
+)
+
+type JournalEntry struct {
+	// Row is the 1-based index of the record in the recipient data.
+	Row       int       `json:"row"`
+	Address   string    `json:"address"`
+	Status    string    `json:"status"`
+	MessageId string    `json:"messageId,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// ErrJournalExists is returned when opening a journal without resuming it, while
+// the journal of a previous run still has entries.
+var ErrJournalExists = errors.New("journal of a previous run exists")
+
+// OpenJournal opens the delivery journal in the given working directory. If
+// `resume` is true, it loads the existing journal entries and appends new
+// entries to the same file. Otherwise, it starts a new journal, and fails with
+// ErrJournalExists if the existing journal isn't empty, so that it isn't lost by
+// accident. Use ResetJournal to discard it first.
+func OpenJournal(dir string, resume bool) (*Journal, error) {
+	stateDir := filepath.Join(dir, journalDir)
+	if err := os.MkdirAll(stateDir, os.ModeDir|os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	j := &Journal{
+		mutex:     sync.Mutex{},
+		delivered: map[int]string{},
+	}
+
+	name := filepath.Join(stateDir, journalFile)
+	if resume {
+		if err := j.load(name); err != nil {
+			return nil, err
+		}
+	} else if info, err := os.Stat(name); err == nil && info.Size() > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrJournalExists, name)
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	j.file = file
+	return j, nil
+}
+
+// ResetJournal discards the delivery journal in the given working directory, if
+// any.
+func ResetJournal(dir string) error {
+	err := os.Remove(filepath.Join(dir, journalDir, journalFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to reset journal: %w", err)
+	}
+
+	return nil
+}
+
+// Journal is a persistent, append-only record of the delivery outcome of each
+// recipient in a send run. It enables resuming interrupted runs without
+// resending emails to the recipients that were already delivered.
+type Journal struct {
+	mutex     sync.Mutex
+	file      *os.File
+	delivered map[int]string
+}
+
+func (j *Journal) load(name string) error {
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		entry := &JournalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return fmt.Errorf("failed to read journal entry on line %d: %w", line, err)
+		}
+
+		if entry.Status == StatusSent {
+			j.delivered[entry.Row] = entry.Address
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	return nil
+}
+
+// IsDelivered reports whether the journal has a successful delivery record for
+// the given row and address.
+func (j *Journal) IsDelivered(row int, address string) bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	a, ok := j.delivered[row]
+	return ok && a == address
+}
+
+// Record appends the given entry to the journal.
+func (j *Journal) Record(entry *JournalEntry) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+
+	if entry.Status == StatusSent {
+		j.delivered[entry.Row] = entry.Address
+	}
+
+	return nil
+}
+
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
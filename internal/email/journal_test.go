@@ -0,0 +1,88 @@
+package email_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trynoice/iris/internal/email"
+)
+
+func TestJournal(t *testing.T) {
+	record := func(t *testing.T, j *email.Journal, row int, address string, status string) {
+		err := j.Record(&email.JournalEntry{Row: row, Address: address, Status: status})
+		require.NoError(t, err)
+	}
+
+	t.Run("WithoutResume", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		j, err := email.OpenJournal(tmpDir, false)
+		require.NoError(t, err)
+		record(t, j, 1, "abc@iris.test", email.StatusSent)
+		require.NoError(t, j.Close())
+
+		j, err = email.OpenJournal(tmpDir, false)
+		assert.ErrorIs(t, err, email.ErrJournalExists)
+		assert.Nil(t, j)
+
+		data, err := os.ReadFile(filepath.Join(tmpDir, ".iris-state", "journal.jsonl"))
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "abc@iris.test")
+	})
+
+	t.Run("WithReset", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, email.ResetJournal(tmpDir))
+
+		j, err := email.OpenJournal(tmpDir, false)
+		require.NoError(t, err)
+		record(t, j, 1, "abc@iris.test", email.StatusSent)
+		require.NoError(t, j.Close())
+
+		require.NoError(t, email.ResetJournal(tmpDir))
+		j, err = email.OpenJournal(tmpDir, false)
+		require.NoError(t, err)
+		assert.False(t, j.IsDelivered(1, "abc@iris.test"))
+		require.NoError(t, j.Close())
+
+		data, err := os.ReadFile(filepath.Join(tmpDir, ".iris-state", "journal.jsonl"))
+		require.NoError(t, err)
+		assert.Empty(t, data)
+	})
+
+	t.Run("WithResume", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		j, err := email.OpenJournal(tmpDir, false)
+		require.NoError(t, err)
+		record(t, j, 1, "abc@iris.test", email.StatusSent)
+		record(t, j, 2, "def@iris.test", email.StatusFailed)
+		assert.True(t, j.IsDelivered(1, "abc@iris.test"))
+		require.NoError(t, j.Close())
+
+		j, err = email.OpenJournal(tmpDir, true)
+		require.NoError(t, err)
+		assert.True(t, j.IsDelivered(1, "abc@iris.test"))
+		assert.False(t, j.IsDelivered(1, "ghi@iris.test"))
+		assert.False(t, j.IsDelivered(2, "def@iris.test"))
+		record(t, j, 2, "def@iris.test", email.StatusSent)
+		require.NoError(t, j.Close())
+
+		data, err := os.ReadFile(filepath.Join(tmpDir, ".iris-state", "journal.jsonl"))
+		require.NoError(t, err)
+		assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 3)
+	})
+
+	t.Run("WithCorruptedJournal", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, ".iris-state"), os.ModePerm))
+		err := os.WriteFile(filepath.Join(tmpDir, ".iris-state", "journal.jsonl"), []byte("{invalid"), os.ModePerm)
+		require.NoError(t, err)
+
+		j, err := email.OpenJournal(tmpDir, true)
+		assert.Error(t, err)
+		assert.Nil(t, j)
+	})
+}
@@ -0,0 +1,112 @@
+package email
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// newJsonDataReader reads the recipient data from a json array of objects, or
+// from json lines with an object on each line if `isJsonl` is true.
+func newJsonDataReader(dataFile io.ReadCloser, isJsonl bool, defaultValues map[string]string) (DataReader, error) {
+	decoder := json.NewDecoder(dataFile)
+	decoder.UseNumber()
+	if !isJsonl {
+		if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+			dataFile.Close()
+			return nil, fmt.Errorf("data json must be an array of objects")
+		}
+	}
+
+	return &jsonDataReader{
+		mutex:         sync.Mutex{},
+		defaultValues: defaultValues,
+		fileCloser:    dataFile,
+		decoder:       decoder,
+		isJsonl:       isJsonl,
+	}, nil
+}
+
+type jsonDataReader struct {
+	mutex         sync.Mutex
+	defaultValues map[string]string
+	fileCloser    io.Closer
+	decoder       *json.Decoder
+	isJsonl       bool
+	isDone        bool
+}
+
+func (r *jsonDataReader) Read() (any, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.isDone {
+		return nil, io.EOF
+	} else if !r.isJsonl && !r.decoder.More() {
+		if _, err := r.decoder.Token(); err != nil {
+			return nil, fmt.Errorf("failed to read record from data json: %w", err)
+		}
+
+		r.isDone = true
+		return nil, io.EOF
+	}
+
+	var value any
+	if err := r.decoder.Decode(&value); err == io.EOF && r.isJsonl {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read record from data json: %w", err)
+	}
+
+	row, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("failed to read record from data json: record must be an object")
+	}
+
+	for key, v := range row {
+		row[key] = jsonValue(v)
+	}
+
+	mergeDefaultValues(row, r.defaultValues)
+	return row, nil
+}
+
+func (r *jsonDataReader) Close() error {
+	return r.fileCloser.Close()
+}
+
+// mergeDefaultValues fills the missing, null or empty values in the given row
+// with the default values.
+func mergeDefaultValues(row map[string]any, defaultValues map[string]string) {
+	for key, defaultValue := range defaultValues {
+		if value, ok := row[key]; !ok || value == nil || value == "" {
+			row[key] = defaultValue
+		}
+	}
+}
+
+// jsonValue converts the json numbers in the given value to int64, or to
+// float64 if they aren't integers, so that templates can compare and print them
+// like the other numbers.
+func jsonValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := v.Float64()
+		return f
+	case []any:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+	case map[string]any:
+		for key := range v {
+			v[key] = jsonValue(v[key])
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,170 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// markdown converts GitHub Flavored Markdown. It omits raw html in the markdown
+// source.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// markdownToHtml converts the given markdown to html.
+func markdownToHtml(source []byte) (string, error) {
+	b := &bytes.Buffer{}
+	if err := markdown.Convert(source, b); err != nil {
+		return "", fmt.Errorf("failed to convert markdown: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+// markdownToText converts the given markdown to plain text. It keeps the
+// document readable, e.g. it renders links as `text (url)` and prefixes list
+// items with their markers, and drops the remaining markdown syntax and raw
+// html.
+func markdownToText(source []byte) string {
+	w := &markdownTextWriter{source: source}
+	s := w.blocks(markdown.Parser().Parse(text.NewReader(source)))
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+type markdownTextWriter struct {
+	source []byte
+}
+
+// blocks renders the child blocks of the given node, separated by blank lines
+// unless they belong to an item of a tight list.
+func (w *markdownTextWriter) blocks(n ast.Node) string {
+	parts := []string{}
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if s := w.block(c); s != "" {
+			parts = append(parts, s)
+		}
+	}
+
+	sep := "\n\n"
+	if list, ok := n.Parent().(*ast.List); ok && list.IsTight {
+		sep = "\n"
+	}
+
+	return strings.Join(parts, sep)
+}
+
+func (w *markdownTextWriter) block(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.Heading, *ast.Paragraph, *ast.TextBlock:
+		return w.inlines(n)
+	case *ast.ThematicBreak:
+		return "---"
+	case *ast.CodeBlock, *ast.FencedCodeBlock:
+		b := strings.Builder{}
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			segment := lines.At(i)
+			b.Write(segment.Value(w.source))
+		}
+
+		return strings.TrimRight(b.String(), "\n")
+	case *ast.Blockquote:
+		return indent(w.blocks(n), "> ", "> ")
+	case *ast.List:
+		items := []string{}
+		number := n.Start
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			marker := "- "
+			if n.IsOrdered() {
+				marker = fmt.Sprintf("%d. ", number)
+				number++
+			}
+
+			items = append(items, indent(w.blocks(c), marker, strings.Repeat(" ", len(marker))))
+		}
+
+		if n.IsTight {
+			return strings.Join(items, "\n")
+		}
+
+		return strings.Join(items, "\n\n")
+	case *extast.Table:
+		rows := []string{}
+		for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+			cells := []string{}
+			for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+				cells = append(cells, w.inlines(cell))
+			}
+
+			rows = append(rows, strings.Join(cells, " | "))
+		}
+
+		return strings.Join(rows, "\n")
+	case *ast.HTMLBlock:
+		return ""
+	}
+
+	return w.blocks(n)
+}
+
+func (w *markdownTextWriter) inlines(n ast.Node) string {
+	b := strings.Builder{}
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Text:
+			b.Write(c.Segment.Value(w.source))
+			if c.SoftLineBreak() || c.HardLineBreak() {
+				b.WriteByte('\n')
+			}
+		case *ast.String:
+			b.Write(c.Value)
+		case *ast.Link:
+			text, url := w.inlines(c), string(c.Destination)
+			if text == "" || text == url {
+				b.WriteString(url)
+			} else {
+				fmt.Fprintf(&b, "%s (%s)", text, url)
+			}
+		case *ast.AutoLink:
+			b.Write(c.URL(w.source))
+		case *ast.RawHTML:
+			// omit raw html, similar to the html conversion.
+		case *extast.TaskCheckBox:
+			if c.IsChecked {
+				b.WriteString("[x] ")
+			} else {
+				b.WriteString("[ ] ")
+			}
+		default:
+			// emphasis, code spans, images (alt text), strikethrough, etc.
+			b.WriteString(w.inlines(c))
+		}
+	}
+
+	return b.String()
+}
+
+// indent prefixes the first line of the given string with `first` and the
+// remaining lines with `rest`.
+func indent(s string, first string, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		if i == 0 {
+			lines[i] = first + lines[i]
+		} else if lines[i] != "" {
+			lines[i] = rest + lines[i]
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
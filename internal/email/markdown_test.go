@@ -0,0 +1,40 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkdownToHtml(t *testing.T) {
+	got, err := markdownToHtml([]byte("# Hello\n\nTom & Jerry <script>alert(1)</script> [docs](https://iris.test)"))
+	require.NoError(t, err)
+	assert.Contains(t, got, "<h1>Hello</h1>")
+	assert.Contains(t, got, "Tom &amp; Jerry")
+	assert.Contains(t, got, `<a href="https://iris.test">docs</a>`)
+	assert.NotContains(t, got, "<script>")
+}
+
+func TestMarkdownToText(t *testing.T) {
+	const source = "# Hello **Jack**\n\n" +
+		"Read the [docs](https://iris.test/docs) or visit <https://iris.test>.\n" +
+		"![logo](cid:logo.png) <b>raw</b> `code`\n\n" +
+		"- one\n- two\n  1. nested\n  2. list\n\n" +
+		"> quoted\n\n" +
+		"```\nfenced code\n```\n\n" +
+		"---\n\n" +
+		"| a | b |\n| - | - |\n| 1 | 2 |\n\n" +
+		"<div>html block</div>\n"
+
+	const want = "Hello Jack\n\n" +
+		"Read the docs (https://iris.test/docs) or visit https://iris.test.\n" +
+		"logo raw code\n\n" +
+		"- one\n- two\n  1. nested\n  2. list\n\n" +
+		"> quoted\n\n" +
+		"fenced code\n\n" +
+		"---\n\n" +
+		"a | b\n1 | 2"
+
+	assert.Equal(t, want, markdownToText([]byte(source)))
+}
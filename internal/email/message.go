@@ -4,4 +4,11 @@ type Message struct {
 	Subject  string
 	TextBody string
 	HtmlBody string
+	// Variant is the name of the A/B test variant that rendered the message.
+	Variant string
+	// Headers are the custom headers of the message.
+	Headers map[string]string
+	// InlineImages are the files that the html body references using `cid:`
+	// urls.
+	InlineImages []*Attachment
 }
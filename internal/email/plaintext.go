@@ -0,0 +1,196 @@
+package email
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var whitespacePattern = regexp.MustCompile(`\s+`)
+
+// htmlToText converts the given html document to plain text. It keeps the
+// document readable, e.g. it renders links as `text (url)` and prefixes list
+// items with their markers, and drops the head, style and script content.
+func htmlToText(s string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse html body: %w", err)
+	}
+
+	w := &htmlTextWriter{}
+	w.node(doc)
+	lines := strings.Split(w.b.String(), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+type htmlTextWriter struct {
+	b strings.Builder
+	// newlines is the number of line breaks to write before the next text.
+	newlines int
+	// space is true if the next text must be separated by a space.
+	space bool
+	pre   int
+	lists []*htmlList
+}
+
+type htmlList struct {
+	ordered bool
+	number  int
+}
+
+// write writes the given text, preceded by the pending line breaks.
+func (w *htmlTextWriter) write(s string) {
+	if s == "" {
+		return
+	}
+
+	if w.b.Len() > 0 {
+		if w.newlines > 0 {
+			w.b.WriteString(strings.Repeat("\n", w.newlines))
+		} else if w.space {
+			w.b.WriteByte(' ')
+		}
+	}
+
+	w.newlines = 0
+	w.space = false
+	w.b.WriteString(s)
+}
+
+// text writes the given text, collapsing the whitespace in it as browsers do.
+func (w *htmlTextWriter) text(s string) {
+	if w.pre > 0 {
+		w.write(s)
+		return
+	}
+
+	s = whitespacePattern.ReplaceAllString(s, " ")
+	if strings.HasPrefix(s, " ") {
+		w.space = true
+	}
+
+	hasTrailingSpace := strings.HasSuffix(s, " ")
+	w.write(strings.TrimSpace(s))
+	if hasTrailingSpace {
+		w.space = true
+	}
+}
+
+// lineBreak requests at least `n` line breaks before the next text.
+func (w *htmlTextWriter) lineBreak(n int) {
+	if w.newlines < n {
+		w.newlines = n
+	}
+}
+
+func (w *htmlTextWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+func (w *htmlTextWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		w.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Img:
+		return
+	case atom.Br:
+		if w.b.Len() > 0 {
+			w.newlines++
+		}
+	case atom.Hr:
+		w.lineBreak(2)
+		w.write("---")
+		w.lineBreak(2)
+	case atom.A:
+		w.link(n)
+	case atom.Ul, atom.Ol:
+		w.lists = append(w.lists, &htmlList{ordered: n.DataAtom == atom.Ol, number: 1})
+		w.lineBreak(1)
+		w.children(n)
+		w.lists = w.lists[:len(w.lists)-1]
+		if len(w.lists) == 0 {
+			w.lineBreak(2)
+		} else {
+			w.lineBreak(1)
+		}
+	case atom.Li:
+		marker := "- "
+		if len(w.lists) > 0 {
+			list := w.lists[len(w.lists)-1]
+			if list.ordered {
+				marker = strconv.Itoa(list.number) + ". "
+				list.number++
+			}
+
+			marker = strings.Repeat("  ", len(w.lists)-1) + marker
+		}
+
+		w.lineBreak(1)
+		w.write(marker)
+		w.children(n)
+		w.lineBreak(1)
+	case atom.Pre:
+		w.lineBreak(2)
+		w.pre++
+		w.children(n)
+		w.pre--
+		w.lineBreak(2)
+	case atom.Td, atom.Th:
+		w.space = true
+		w.children(n)
+		w.space = true
+	case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Blockquote, atom.Table:
+		w.lineBreak(2)
+		w.children(n)
+		w.lineBreak(2)
+	case atom.Div, atom.Tr, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Main, atom.Nav, atom.Aside:
+		w.lineBreak(1)
+		w.children(n)
+		w.lineBreak(1)
+	default:
+		w.children(n)
+	}
+}
+
+// link writes the text of the given anchor followed by its url, unless the url
+// is a fragment or the same as the text.
+func (w *htmlTextWriter) link(n *html.Node) {
+	href := ""
+	for _, attr := range n.Attr {
+		if attr.Key == "href" {
+			href = strings.TrimSpace(attr.Val)
+		}
+	}
+
+	start := w.b.Len()
+	w.children(n)
+	text := strings.TrimSpace(w.b.String()[start:])
+	if href == "" || strings.HasPrefix(href, "#") || text == strings.TrimPrefix(href, "mailto:") {
+		return
+	}
+
+	if text == "" {
+		w.write(href)
+	} else {
+		w.space = true
+		w.write("(" + href + ")")
+	}
+}
@@ -0,0 +1,52 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHtmlToText(t *testing.T) {
+	const source = `<!doctype html>
+<html>
+  <head>
+    <title>Ignored</title>
+    <style>p { color: red; }</style>
+  </head>
+  <body>
+    <script>alert("ignored")</script>
+    <h1>Hello   Jack</h1>
+    <p>
+      Read the <a href="https://iris.test/docs">docs</a>, visit
+      <a href="https://iris.test">https://iris.test</a> or
+      <a href="mailto:help@iris.test">help@iris.test</a>.<br>Thanks &amp; bye!
+    </p>
+    <img src="cid:logo.png" alt="Logo">
+    <ul>
+      <li>one</li>
+      <li>two
+        <ol><li>nested</li><li>list</li></ol>
+      </li>
+    </ul>
+    <table><tr><td>a</td><td>b</td></tr><tr><td>c</td><td>d</td></tr></table>
+    <hr>
+    <pre>pre
+  formatted</pre>
+    <div>last</div>
+  </body>
+</html>`
+
+	const want = "Hello Jack\n\n" +
+		"Read the docs (https://iris.test/docs), visit https://iris.test or help@iris.test.\n" +
+		"Thanks & bye!\n\n" +
+		"- one\n- two\n  1. nested\n  2. list\n\n" +
+		"a b\nc d\n\n" +
+		"---\n\n" +
+		"pre\n  formatted\n\n" +
+		"last"
+
+	got, err := htmlToText(source)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,118 @@
+package email
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	StatusSent       = "sent"
+	StatusFailed     = "failed"
+	StatusSkipped    = "skipped"
+	StatusSuppressed = "suppressed"
+	// StatusDryRun marks the emails that were rendered but not sent in a dry
+	// run.
+	StatusDryRun = "dry-run"
+)
+
+type ReportEntry struct {
+	// Row is the 1-based index of the record in the recipient data.
+	Row       int    `json:"row"`
+	Address   string `json:"address"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	MessageId string `json:"messageId,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Variant   string `json:"variant,omitempty"`
+}
+
+var reportCsvHeaders = []string{"row", "address", "status", "attempts", "messageId", "error", "variant"}
+
+// NewReportWriter creates the report file with the given name. It writes CSV
+// if the name has a `.csv` extension and JSON lines if it has a `.json`,
+// `.jsonl` or `.ndjson` extension.
+func NewReportWriter(name string) (*ReportWriter, error) {
+	var isCsv bool
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		isCsv = true
+	case ".json", ".jsonl", ".ndjson":
+		isCsv = false
+	default:
+		return nil, fmt.Errorf("unrecognised report format: %s", name)
+	}
+
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create report: %w", err)
+	}
+
+	w := &ReportWriter{
+		mutex:      sync.Mutex{},
+		fileCloser: file,
+	}
+
+	if isCsv {
+		w.csvWriter = csv.NewWriter(file)
+		if err := w.csvWriter.Write(reportCsvHeaders); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write report headers: %w", err)
+		}
+	} else {
+		w.jsonEncoder = json.NewEncoder(file)
+	}
+
+	return w, nil
+}
+
+// ReportWriter writes the outcome of each recipient in a send run to a file.
+type ReportWriter struct {
+	mutex       sync.Mutex
+	fileCloser  io.Closer
+	csvWriter   *csv.Writer
+	jsonEncoder *json.Encoder
+}
+
+func (w *ReportWriter) Write(entry *ReportEntry) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.jsonEncoder != nil {
+		if err := w.jsonEncoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to write report entry: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := w.csvWriter.Write([]string{
+		strconv.Itoa(entry.Row),
+		entry.Address,
+		entry.Status,
+		strconv.Itoa(entry.Attempts),
+		entry.MessageId,
+		entry.Error,
+		entry.Variant,
+	}); err != nil {
+		return fmt.Errorf("failed to write report entry: %w", err)
+	}
+
+	// flush eagerly so that the report is usable even if the run crashes.
+	w.csvWriter.Flush()
+	if err := w.csvWriter.Error(); err != nil {
+		return fmt.Errorf("failed to write report entry: %w", err)
+	}
+
+	return nil
+}
+
+func (w *ReportWriter) Close() error {
+	return w.fileCloser.Close()
+}
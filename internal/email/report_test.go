@@ -0,0 +1,53 @@
+package email_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trynoice/iris/internal/email"
+)
+
+func TestReportWriter(t *testing.T) {
+	entries := []*email.ReportEntry{
+		{Row: 1, Address: "abc@iris.test", Status: email.StatusSent, Attempts: 1, MessageId: "test-id", Variant: "A"},
+		{Row: 2, Address: "def@iris.test", Status: email.StatusFailed, Attempts: 3, Error: "test-error"},
+		{Row: 3, Address: "ghi@iris.test", Status: email.StatusSkipped},
+	}
+
+	write := func(t *testing.T, name string) string {
+		w, err := email.NewReportWriter(name)
+		require.NoError(t, err)
+		for _, e := range entries {
+			require.NoError(t, w.Write(e))
+		}
+
+		require.NoError(t, w.Close())
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	t.Run("WithCsvFile", func(t *testing.T) {
+		got := write(t, filepath.Join(t.TempDir(), "report.csv"))
+		assert.Equal(t, "row,address,status,attempts,messageId,error,variant\n"+
+			"1,abc@iris.test,sent,1,test-id,,A\n"+
+			"2,def@iris.test,failed,3,,test-error,\n"+
+			"3,ghi@iris.test,skipped,0,,,\n", got)
+	})
+
+	t.Run("WithJsonLinesFile", func(t *testing.T) {
+		got := write(t, filepath.Join(t.TempDir(), "report.jsonl"))
+		assert.Equal(t, `{"row":1,"address":"abc@iris.test","status":"sent","attempts":1,"messageId":"test-id","variant":"A"}`+"\n"+
+			`{"row":2,"address":"def@iris.test","status":"failed","attempts":3,"error":"test-error"}`+"\n"+
+			`{"row":3,"address":"ghi@iris.test","status":"skipped","attempts":0}`+"\n", got)
+	})
+
+	t.Run("WithUnknownFormat", func(t *testing.T) {
+		w, err := email.NewReportWriter(filepath.Join(t.TempDir(), "report.txt"))
+		assert.Error(t, err)
+		assert.Nil(t, w)
+	})
+}
@@ -1,12 +1,25 @@
 package email
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	mathrand "math/rand"
+	netmail "net/mail"
+	"net/textproto"
+	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ses"
 	"github.com/mitchellh/go-wordwrap"
@@ -18,15 +31,73 @@ import (
 )
 
 type Service interface {
-	Send(opts *SendOptions) error
+	Send(opts *SendOptions) (*SendResult, error)
 	io.Closer
 }
 
 type SendOptions struct {
 	From    string
 	ReplyTo []string
-	To      string
+	To      []string
+	Cc      []string
+	Bcc     []string
 	Message *Message
+	// Attachments are the files to attach to the message.
+	Attachments []*Attachment
+}
+
+type SendResult struct {
+	// MessageId is the identifier that the upstream provider assigned to the
+	// sent message, if any.
+	MessageId string
+	// Attempts is the number of times the message was submitted to the
+	// upstream provider. Only the services decorated with `WithRetries` set it.
+	Attempts int
+}
+
+// composeEmail builds a MIME message from the given options. Callers must check
+// the returned email for errors.
+func composeEmail(opts *SendOptions) *mail.Email {
+	e := mail.NewMSG().
+		SetFrom(opts.From).
+		AddTo(opts.To...).
+		SetSubject(opts.Message.Subject)
+
+	// omit the missing part for the text-only and html-only messages.
+	if opts.Message.HtmlBody == "" {
+		e.SetBody(mail.TextPlain, opts.Message.TextBody)
+	} else if opts.Message.TextBody == "" {
+		e.SetBody(mail.TextHTML, opts.Message.HtmlBody)
+	} else {
+		e.SetBody(mail.TextPlain, opts.Message.TextBody).
+			AddAlternative(mail.TextHTML, opts.Message.HtmlBody)
+	}
+
+	if len(opts.ReplyTo) > 0 {
+		e.SetReplyTo(strings.Join(opts.ReplyTo, ", "))
+	}
+
+	if len(opts.Cc) > 0 {
+		e.AddCc(opts.Cc...)
+	}
+
+	if len(opts.Bcc) > 0 {
+		e.AddBcc(opts.Bcc...)
+	}
+
+	for name, value := range opts.Message.Headers {
+		e.AddHeader(name, value)
+	}
+
+	for _, a := range opts.Message.InlineImages {
+		e.Attach(&mail.File{Name: a.Name, Data: a.Data, Inline: true})
+	}
+
+	for _, a := range opts.Attachments {
+		e.Attach(&mail.File{Name: a.Name, Data: a.Data})
+	}
+
+	return e
 }
 
 type ServiceOption func(upstream Service) Service
@@ -60,59 +131,55 @@ func NewAwsSesServiceWithClient(client AwsSesClient, opts ...ServiceOption) Serv
 }
 
 type AwsSesClient interface {
-	// SendEmail API operation for Amazon Simple Email Service.
-	SendEmail(input *ses.SendEmailInput) (*ses.SendEmailOutput, error)
+	// SendRawEmail API operation for Amazon Simple Email Service.
+	SendRawEmail(input *ses.SendRawEmailInput) (*ses.SendRawEmailOutput, error)
 }
 
 type awsSesService struct {
 	client AwsSesClient
 }
 
-func (s *awsSesService) Send(opts *SendOptions) error {
+func (s *awsSesService) Send(opts *SendOptions) (*SendResult, error) {
 	if opts == nil {
-		return fmt.Errorf("send options must not be nil")
+		return nil, permanent(fmt.Errorf("send options must not be nil"))
 	}
 
 	if opts.Message == nil {
-		return fmt.Errorf("message must not be nil")
+		return nil, permanent(fmt.Errorf("message must not be nil"))
 	}
 
-	if _, err := s.client.SendEmail(&ses.SendEmailInput{
-		Source:           aws.String(opts.From),
-		ReplyToAddresses: aws.StringSlice(opts.ReplyTo),
-		Destination: &ses.Destination{
-			ToAddresses: []*string{
-				aws.String(opts.To),
-			},
-		},
-		Message: &ses.Message{
-			Subject: &ses.Content{
-				Charset: aws.String("utf-8"),
-				Data:    aws.String(opts.Message.Subject),
-			},
-			Body: &ses.Body{
-				Text: &ses.Content{
-					Charset: aws.String("utf-8"),
-					Data:    aws.String(opts.Message.TextBody),
-				},
-				Html: &ses.Content{
-					Charset: aws.String("utf-8"),
-					Data:    aws.String(opts.Message.HtmlBody),
-				},
-			},
+	// ses assigns its own message ids, so there is no need to generate one.
+	e := composeEmail(opts)
+	if err := e.GetError(); err != nil {
+		return nil, permanent(fmt.Errorf("failed to compose email: %w", err))
+	}
+
+	destinations := make([]string, 0, len(opts.To)+len(opts.Cc)+len(opts.Bcc))
+	destinations = append(destinations, opts.To...)
+	destinations = append(destinations, opts.Cc...)
+	destinations = append(destinations, opts.Bcc...)
+	out, err := s.client.SendRawEmail(&ses.SendRawEmailInput{
+		Source:       aws.String(opts.From),
+		Destinations: aws.StringSlice(destinations),
+		RawMessage: &ses.RawMessage{
+			Data: []byte(e.GetMessage()),
 		},
-	}); err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send email: %w", err)
 	}
 
-	return nil
+	return &SendResult{MessageId: aws.StringValue(out.MessageId)}, nil
 }
 
 func (s *awsSesService) Close() error {
 	return nil
 }
 
-func NewSmtpService(cfg *config.SmtpServiceConfig, opts ...ServiceOption) (Service, error) {
+// NewSmtpService creates a service that sends emails using the given SMTP
+// server. It opens up to `connections` connections to the server so that
+// concurrent sends don't wait on each other.
+func NewSmtpService(cfg *config.SmtpServiceConfig, connections int, opts ...ServiceOption) (Service, error) {
 	c := mail.NewSMTPClient()
 	c.Host = cfg.Host
 	c.Port = cfg.Port
@@ -135,51 +202,143 @@ func NewSmtpService(cfg *config.SmtpServiceConfig, opts ...ServiceOption) (Servi
 		return nil, fmt.Errorf("unrecognised smtp encryption type: %s", cfg.Encryption)
 	}
 
-	client, err := c.Connect()
+	var dkimKey []byte
+	if cfg.Dkim != nil {
+		var err error
+		if dkimKey, err = os.ReadFile(cfg.Dkim.PrivateKeyFile); err != nil {
+			return nil, fmt.Errorf("failed to read dkim private key: %w", err)
+		}
+	}
+
+	dial := func() (SmtpClient, error) {
+		client, err := c.Connect()
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to smtp server: %w", err)
+		}
+
+		if cfg.Dkim != nil {
+			signer, err := NewDkimSmtpClient(&smtpClientImpl{client}, cfg.Dkim, dkimKey)
+			if err != nil {
+				client.Close()
+				return nil, err
+			}
+
+			return signer, nil
+		}
+
+		return &smtpClientImpl{client}, nil
+	}
+
+	// connect eagerly to surface configuration errors before sending anything.
+	client, err := dial()
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to smtp server: %w", err)
+		return nil, err
 	}
 
-	return NewSmtpServiceWithClient(&smtpClientImpl{client}, opts...), nil
+	return ApplyOptions(newSmtpService(client, dial, connections), opts...), nil
 }
 
 func NewSmtpServiceWithClient(client SmtpClient, opts ...ServiceOption) Service {
-	return ApplyOptions(&smtpService{client: client}, opts...)
+	return ApplyOptions(newSmtpService(client, nil, 1), opts...)
 }
 
+func newSmtpService(client SmtpClient, dial func() (SmtpClient, error), maxClients int) *smtpService {
+	if maxClients < 1 {
+		maxClients = 1
+	}
+
+	s := &smtpService{
+		mutex:   sync.Mutex{},
+		dial:    dial,
+		clients: []SmtpClient{client},
+		idle:    make(chan SmtpClient, maxClients),
+	}
+
+	s.idle <- client
+	return s
+}
+
+// smtpService maintains a pool of SMTP clients since a client can only send one
+// email at a time.
 type smtpService struct {
-	client SmtpClient
+	mutex   sync.Mutex
+	dial    func() (SmtpClient, error)
+	clients []SmtpClient
+	idle    chan SmtpClient
+}
+
+// acquire returns an idle client from the pool. If none is idle, it connects a
+// new client unless the pool is full, in which case it waits for a client to
+// become idle.
+func (s *smtpService) acquire() (SmtpClient, error) {
+	select {
+	case client := <-s.idle:
+		return client, nil
+	default:
+	}
+
+	s.mutex.Lock()
+	if s.dial != nil && len(s.clients) < cap(s.idle) {
+		defer s.mutex.Unlock()
+		client, err := s.dial()
+		if err != nil {
+			return nil, err
+		}
+
+		s.clients = append(s.clients, client)
+		return client, nil
+	}
+
+	s.mutex.Unlock()
+	return <-s.idle, nil
 }
 
-func (s *smtpService) Send(opts *SendOptions) error {
+func (s *smtpService) release(client SmtpClient) {
+	s.idle <- client
+}
+
+func (s *smtpService) Send(opts *SendOptions) (*SendResult, error) {
 	if opts == nil {
-		return fmt.Errorf("send options must not be nil")
+		return nil, permanent(fmt.Errorf("send options must not be nil"))
 	}
 
 	if opts.Message == nil {
-		return fmt.Errorf("message must not be nil")
+		return nil, permanent(fmt.Errorf("message must not be nil"))
 	}
 
-	e := mail.NewMSG().
-		SetFrom(opts.From).
-		AddTo(opts.To).
-		SetSubject(opts.Message.Subject).
-		SetBody(mail.TextPlain, opts.Message.TextBody).
-		AddAlternative(mail.TextHTML, opts.Message.HtmlBody)
+	messageId, err := newMessageId(opts.From)
+	if err != nil {
+		return nil, err
+	}
 
-	if len(opts.ReplyTo) > 0 {
-		e.SetReplyTo(strings.Join(opts.ReplyTo, ", "))
+	e := composeEmail(opts).AddHeader("Message-ID", messageId)
+	if err := e.GetError(); err != nil {
+		return nil, permanent(fmt.Errorf("failed to compose email: %w", err))
+	}
+
+	client, err := s.acquire()
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.client.SendEmail(e); err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+	defer s.release(client)
+	if err := client.SendEmail(e); err != nil {
+		return nil, fmt.Errorf("failed to send email: %w", err)
 	}
 
-	return nil
+	return &SendResult{MessageId: messageId}, nil
 }
 
 func (s *smtpService) Close() error {
-	return s.client.Close()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	errs := make([]error, 0, len(s.clients))
+	for _, client := range s.clients {
+		errs = append(errs, client.Close())
+	}
+
+	return errors.Join(errs...)
 }
 
 type SmtpClient interface {
@@ -199,21 +358,40 @@ func (c *smtpClientImpl) Close() error {
 	return c.client.Close()
 }
 
+// newMessageId generates a unique value for the 'Message-ID' header using the
+// domain of the given sender address.
+func newMessageId(from string) (string, error) {
+	domain := "localhost"
+	if addr, err := netmail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i > -1 {
+			domain = addr.Address[i+1:]
+		}
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate message id: %w", err)
+	}
+
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain), nil
+}
+
 func NewPrintService(w io.Writer, opts ...ServiceOption) Service {
-	return ApplyOptions(&printService{w: w}, opts...)
+	return ApplyOptions(&printService{mutex: sync.Mutex{}, w: w}, opts...)
 }
 
 type printService struct {
-	w io.Writer
+	mutex sync.Mutex
+	w     io.Writer
 }
 
-func (s *printService) Send(opts *SendOptions) error {
+func (s *printService) Send(opts *SendOptions) (*SendResult, error) {
 	if opts == nil {
-		return fmt.Errorf("send options must not be nil")
+		return nil, permanent(fmt.Errorf("send options must not be nil"))
 	}
 
 	if opts.Message == nil {
-		return fmt.Errorf("message must not be nil")
+		return nil, permanent(fmt.Errorf("message must not be nil"))
 	}
 
 	pw := getTerminalWidth(100)
@@ -225,17 +403,66 @@ func (s *printService) Send(opts *SendOptions) error {
 		pw = 100
 	}
 
+	// prevent tables from interleaving when invoked concurrently.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	tw := tablewriter.NewWriter(s.w)
 	tw.SetColWidth(pw)
 	tw.SetAutoWrapText(false)
 	tw.SetRowLine(true)
-	tw.AppendBulk([][]string{
-		{"Subject", wordwrap.WrapString(opts.Message.Subject, uint(pw))},
-		{"Text Body", wordwrap.WrapString(opts.Message.TextBody, uint(pw))},
-		{"HTML Body", wordwrap.WrapString(opts.Message.HtmlBody, uint(pw))},
-	})
+	tw.Append([]string{"To", wordwrap.WrapString(strings.Join(opts.To, ", "), uint(pw))})
+	if len(opts.Cc) > 0 {
+		tw.Append([]string{"Cc", wordwrap.WrapString(strings.Join(opts.Cc, ", "), uint(pw))})
+	}
+
+	if len(opts.Bcc) > 0 {
+		tw.Append([]string{"Bcc", wordwrap.WrapString(strings.Join(opts.Bcc, ", "), uint(pw))})
+	}
+
+	if len(opts.Message.Headers) > 0 {
+		headers := make([]string, 0, len(opts.Message.Headers))
+		for name, value := range opts.Message.Headers {
+			headers = append(headers, name+": "+value)
+		}
+
+		sort.Strings(headers)
+		tw.Append([]string{"Headers", wordwrap.WrapString(strings.Join(headers, "\n"), uint(pw))})
+	}
+
+	if opts.Message.Variant != "" {
+		tw.Append([]string{"Variant", opts.Message.Variant})
+	}
+
+	tw.Append([]string{"Subject", wordwrap.WrapString(opts.Message.Subject, uint(pw))})
+	if opts.Message.TextBody != "" {
+		tw.Append([]string{"Text Body", wordwrap.WrapString(opts.Message.TextBody, uint(pw))})
+	}
+
+	if opts.Message.HtmlBody != "" {
+		tw.Append([]string{"HTML Body", wordwrap.WrapString(opts.Message.HtmlBody, uint(pw))})
+	}
+
+	for _, files := range []struct {
+		title       string
+		attachments []*Attachment
+	}{
+		{"Inline", opts.Message.InlineImages},
+		{"Attachments", opts.Attachments},
+	} {
+		if len(files.attachments) == 0 {
+			continue
+		}
+
+		names := make([]string, 0, len(files.attachments))
+		for _, a := range files.attachments {
+			names = append(names, fmt.Sprintf("%s (%d bytes)", a.Name, len(a.Data)))
+		}
+
+		tw.Append([]string{files.title, wordwrap.WrapString(strings.Join(names, "\n"), uint(pw))})
+	}
 	tw.Render()
-	return nil
+	return &SendResult{}, nil
 }
 
 func (s *printService) Close() error {
@@ -264,7 +491,7 @@ type rateLimitedService struct {
 	limiter  ratelimit.Limiter
 }
 
-func (s *rateLimitedService) Send(opts *SendOptions) error {
+func (s *rateLimitedService) Send(opts *SendOptions) (*SendResult, error) {
 	s.limiter.Take()
 	return s.upstream.Send(opts)
 }
@@ -273,36 +500,136 @@ func (s *rateLimitedService) Close() error {
 	return s.upstream.Close()
 }
 
-func WithRetries(retryCount int) ServiceOption {
+type RetryPolicy struct {
+	// Retries is the maximum number of times to retry a failed send.
+	Retries int
+	// BaseDelay is the delay before the first retry. It doubles with each
+	// subsequent retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between retries. Zero means no cap.
+	MaxDelay time.Duration
+	// Jitter is the fraction (between 0 and 1) of each delay that is
+	// randomised to avoid retrying in lockstep.
+	Jitter float64
+	// IsRetryable reports whether a failed send should be retried. It defaults
+	// to `IsRetryableError`.
+	IsRetryable func(err error) bool
+}
+
+// delay returns the backoff duration before the given retry (1-based).
+func (p *RetryPolicy) delay(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < retry && d < math.MaxInt64/2; i++ {
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			break
+		}
+
+		d *= 2
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	jitter := math.Max(0, math.Min(1, p.Jitter))
+	return d - time.Duration(mathrand.Float64()*jitter*float64(d))
+}
+
+func WithRetries(policy RetryPolicy) ServiceOption {
+	if policy.IsRetryable == nil {
+		policy.IsRetryable = IsRetryableError
+	}
+
 	return func(upstream Service) Service {
 		return &retryService{
-			upstream:   upstream,
-			retryCount: retryCount,
+			upstream: upstream,
+			policy:   policy,
 		}
 	}
 }
 
 type retryService struct {
-	upstream   Service
-	retryCount int
+	upstream Service
+	policy   RetryPolicy
 }
 
-func (s *retryService) Send(opts *SendOptions) error {
+// Send returns a non-nil result even if it fails so that callers can inspect
+// the number of attempts.
+func (s *retryService) Send(opts *SendOptions) (*SendResult, error) {
+	var result *SendResult
 	var err error
-	for i := 0; i <= s.retryCount; i++ {
-		err = s.upstream.Send(opts)
-		if err == nil {
+	attempts := 0
+	for attempts <= s.policy.Retries {
+		if attempts > 0 {
+			time.Sleep(s.policy.delay(attempts))
+		}
+
+		attempts++
+		result, err = s.upstream.Send(opts)
+		if err == nil || !s.policy.IsRetryable(err) {
 			break
 		}
 	}
 
-	return err
+	if result == nil {
+		result = &SendResult{}
+	}
+
+	result.Attempts = attempts
+	return result, err
 }
 
 func (s *retryService) Close() error {
 	return s.upstream.Close()
 }
 
+// permanentError wraps the errors that recur on each attempt, e.g. when an email
+// can't be composed due to an invalid address.
+type permanentError struct {
+	err error
+}
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// IsRetryableError reports whether the given send error is likely transient.
+// It treats AWS throttling and server errors, and SMTP 4xx replies as
+// transient, and other AWS errors, SMTP 5xx replies and the errors that occur
+// before sending, e.g. invalid addresses, as permanent. It considers all other
+// errors, e.g. network errors, transient.
+func IsRetryableError(err error) bool {
+	var permanentErr *permanentError
+	if errors.As(err, &permanentErr) {
+		return false
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		var reqErr awserr.RequestFailure
+		if errors.As(err, &reqErr) && reqErr.StatusCode() >= 500 {
+			return true
+		}
+
+		return request.IsErrorThrottle(awsErr) || request.IsErrorRetryable(awsErr)
+	}
+
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500
+	}
+
+	return true
+}
+
 // ApplyOptions wraps the given `upstream` service in the given service options
 // (decorators).
 func ApplyOptions(upstream Service, opts ...ServiceOption) Service {
@@ -3,10 +3,14 @@ package email_test
 import (
 	"bytes"
 	"fmt"
+	"net/textproto"
+	"regexp"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ses"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,11 +20,11 @@ import (
 
 func TestAwsSesService(t *testing.T) {
 	t.Run("WithNilMessage", func(t *testing.T) {
-		c := &FakeAwsSesClient{RespondWithOutput: &ses.SendEmailOutput{}}
+		c := &FakeAwsSesClient{RespondWithOutput: &ses.SendRawEmailOutput{}}
 		s := email.NewAwsSesServiceWithClient(c)
-		err := s.Send(&email.SendOptions{
+		_, err := s.Send(&email.SendOptions{
 			From: "test-from",
-			To:   "test-to",
+			To:   []string{"test-to"},
 		})
 		assert.Error(t, err)
 	})
@@ -28,50 +32,79 @@ func TestAwsSesService(t *testing.T) {
 	t.Run("WithUpstreamError", func(t *testing.T) {
 		c := &FakeAwsSesClient{RespondWithError: fmt.Errorf("test-error")}
 		s := email.NewAwsSesServiceWithClient(c)
-		err := s.Send(&email.SendOptions{
-			From:    "test-from",
-			To:      "test-to",
+		_, err := s.Send(&email.SendOptions{
+			From:    "from@iris.test",
+			To:      []string{"to@iris.test"},
 			Message: &email.Message{},
 		})
 		assert.Error(t, err)
+		assert.NotNil(t, c.LastSendRawEmailInput)
 	})
 
 	t.Run("WithNoError", func(t *testing.T) {
 		sendOpts := &email.SendOptions{
-			From:    "test-from",
-			To:      "test-to",
-			ReplyTo: []string{"test-reply-to"},
+			From:    "from@iris.test",
+			To:      []string{"to@iris.test", "to-2@iris.test"},
+			Cc:      []string{"cc@iris.test"},
+			Bcc:     []string{"bcc@iris.test"},
+			ReplyTo: []string{"reply-to@iris.test"},
 			Message: &email.Message{
 				Subject:  "test-subject",
 				TextBody: "test-text-body",
 				HtmlBody: "test-html-body",
+				Headers: map[string]string{
+					"List-Unsubscribe": "<https://iris.test/unsubscribe>",
+				},
+			},
+			Attachments: []*email.Attachment{
+				{Name: "test.txt", Data: []byte("test-attachment")},
 			},
 		}
 
-		c := &FakeAwsSesClient{RespondWithOutput: &ses.SendEmailOutput{}}
+		c := &FakeAwsSesClient{RespondWithOutput: &ses.SendRawEmailOutput{MessageId: aws.String("test-message-id")}}
 		s := email.NewAwsSesServiceWithClient(c)
-		err := s.Send(sendOpts)
+		result, err := s.Send(sendOpts)
 		assert.NoError(t, err)
+		assert.Equal(t, "test-message-id", result.MessageId)
 
-		i := c.LastSendEmailInput
+		i := c.LastSendRawEmailInput
 		assert.Equal(t, sendOpts.From, *i.Source)
-		assert.Equal(t, sendOpts.To, *i.Destination.ToAddresses[0])
-		assert.Equal(t, sendOpts.ReplyTo, aws.StringValueSlice(i.ReplyToAddresses))
-		assert.Equal(t, sendOpts.Message.Subject, *i.Message.Subject.Data)
-		assert.Equal(t, sendOpts.Message.TextBody, *i.Message.Body.Text.Data)
-		assert.Equal(t, sendOpts.Message.HtmlBody, *i.Message.Body.Html.Data)
+		assert.Equal(t, []string{"to@iris.test", "to-2@iris.test", "cc@iris.test", "bcc@iris.test"}, aws.StringValueSlice(i.Destinations))
+
+		raw := string(i.RawMessage.Data)
+		assert.Contains(t, raw, "To: <to@iris.test>, <to-2@iris.test>")
+		assert.Contains(t, raw, "Cc: <cc@iris.test>")
+		assert.NotContains(t, raw, "bcc@iris.test")
+		assert.Contains(t, raw, "Reply-To: <reply-to@iris.test>")
+		assert.Contains(t, raw, sendOpts.Message.Subject)
+		assert.Contains(t, raw, sendOpts.Message.TextBody)
+		assert.Contains(t, raw, sendOpts.Message.HtmlBody)
+		assert.Contains(t, raw, `filename="test.txt"`)
+		assert.Contains(t, raw, "List-Unsubscribe: <https://iris.test/unsubscribe>")
+	})
+
+	t.Run("WithInvalidAddress", func(t *testing.T) {
+		c := &FakeAwsSesClient{RespondWithOutput: &ses.SendRawEmailOutput{}}
+		s := email.NewAwsSesServiceWithClient(c)
+		_, err := s.Send(&email.SendOptions{
+			From:    "test-from",
+			To:      []string{"test-to"},
+			Message: &email.Message{},
+		})
+		assert.Error(t, err)
+		assert.Nil(t, c.LastSendRawEmailInput)
 	})
 }
 
 type FakeAwsSesClient struct {
-	RespondWithOutput  *ses.SendEmailOutput
-	RespondWithError   error
-	LastSendEmailInput *ses.SendEmailInput
+	RespondWithOutput     *ses.SendRawEmailOutput
+	RespondWithError      error
+	LastSendRawEmailInput *ses.SendRawEmailInput
 }
 
-// SendEmail API operation for Amazon Simple Email Service.
-func (c *FakeAwsSesClient) SendEmail(input *ses.SendEmailInput) (*ses.SendEmailOutput, error) {
-	c.LastSendEmailInput = input
+// SendRawEmail API operation for Amazon Simple Email Service.
+func (c *FakeAwsSesClient) SendRawEmail(input *ses.SendRawEmailInput) (*ses.SendRawEmailOutput, error) {
+	c.LastSendRawEmailInput = input
 	return c.RespondWithOutput, c.RespondWithError
 }
 
@@ -79,9 +112,9 @@ func TestSmtpService(t *testing.T) {
 	t.Run("WithNilMessage", func(t *testing.T) {
 		c := &FakeSmtpClient{RespondWithError: nil}
 		s := email.NewSmtpServiceWithClient(c)
-		err := s.Send(&email.SendOptions{
+		_, err := s.Send(&email.SendOptions{
 			From: "test-from",
-			To:   "test-to",
+			To:   []string{"test-to"},
 		})
 		assert.Error(t, err)
 	})
@@ -89,19 +122,22 @@ func TestSmtpService(t *testing.T) {
 	t.Run("WithUpstreamError", func(t *testing.T) {
 		c := &FakeSmtpClient{RespondWithError: fmt.Errorf("test-error")}
 		s := email.NewSmtpServiceWithClient(c)
-		err := s.Send(&email.SendOptions{
-			From:    "test-from",
-			To:      "test-to",
+		_, err := s.Send(&email.SendOptions{
+			From:    "from@iris.test",
+			To:      []string{"to@iris.test"},
 			Message: &email.Message{},
 		})
 		assert.Error(t, err)
+		assert.NotNil(t, c.LastSentEmail)
 	})
 
 	t.Run("WithNoError", func(t *testing.T) {
 		sendOpts := &email.SendOptions{
-			From:    "test-from",
-			To:      "test-to",
-			ReplyTo: []string{"test-reply-to"},
+			From:    "from@iris.test",
+			To:      []string{"to@iris.test", "to-2@iris.test"},
+			Cc:      []string{"cc@iris.test"},
+			Bcc:     []string{"bcc@iris.test"},
+			ReplyTo: []string{"reply-to@iris.test"},
 			Message: &email.Message{
 				Subject:  "test-subject",
 				TextBody: "test-text-body",
@@ -111,11 +147,85 @@ func TestSmtpService(t *testing.T) {
 
 		c := &FakeSmtpClient{RespondWithError: nil}
 		s := email.NewSmtpServiceWithClient(c)
-		err := s.Send(sendOpts)
+		result, err := s.Send(sendOpts)
 		assert.NoError(t, err)
 		assert.NotNil(t, c.LastSentEmail)
+		assert.NotEmpty(t, result.MessageId)
+		assert.NoError(t, c.LastSentEmail.GetError())
+		assert.Contains(t, c.LastSentEmail.GetMessage(), "Message-Id: "+result.MessageId)
+		assert.ElementsMatch(t, []string{"to@iris.test", "to-2@iris.test", "cc@iris.test", "bcc@iris.test"}, c.LastSentEmail.GetRecipients())
 		// TODO: figure out a way to check email data.
 	})
+
+	t.Run("WithSinglePart", func(t *testing.T) {
+		for _, test := range []struct {
+			message         *email.Message
+			wantContentType string
+			notContentType  string
+		}{
+			{
+				message:         &email.Message{Subject: "test-subject", TextBody: "test-text-body"},
+				wantContentType: "text/plain",
+				notContentType:  "text/html",
+			},
+			{
+				message:         &email.Message{Subject: "test-subject", HtmlBody: "test-html-body"},
+				wantContentType: "text/html",
+				notContentType:  "text/plain",
+			},
+		} {
+			c := &FakeSmtpClient{RespondWithError: nil}
+			s := email.NewSmtpServiceWithClient(c)
+			_, err := s.Send(&email.SendOptions{From: "from@iris.test", To: []string{"to@iris.test"}, Message: test.message})
+			assert.NoError(t, err)
+
+			raw := c.LastSentEmail.GetMessage()
+			assert.Contains(t, raw, "Content-Type: "+test.wantContentType)
+			assert.NotContains(t, raw, "Content-Type: "+test.notContentType)
+			assert.NotContains(t, raw, "multipart/alternative")
+		}
+	})
+
+	t.Run("WithInlineImages", func(t *testing.T) {
+		c := &FakeSmtpClient{RespondWithError: nil}
+		s := email.NewSmtpServiceWithClient(c)
+		_, err := s.Send(&email.SendOptions{
+			From: "from@iris.test",
+			To:   []string{"to@iris.test"},
+			Message: &email.Message{
+				HtmlBody:     `<img src="cid:logo.png">`,
+				InlineImages: []*email.Attachment{{Name: "logo.png", Data: []byte("test-logo")}},
+			},
+		})
+		assert.NoError(t, err)
+
+		raw := c.LastSentEmail.GetMessage()
+		assert.Contains(t, raw, "multipart/related")
+		cid := regexp.MustCompile(`Content-Id: <(.+)>`).FindStringSubmatch(raw)
+		require.Len(t, cid, 2)
+		assert.Contains(t, raw, `src=3D"cid:`+cid[1]+`"`)
+	})
+
+	t.Run("WithConcurrentSends", func(t *testing.T) {
+		c := &FakeSmtpClient{RespondWithError: nil}
+		s := email.NewSmtpServiceWithClient(c)
+		wg := sync.WaitGroup{}
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := s.Send(&email.SendOptions{
+					From:    "from@iris.test",
+					To:      []string{"to@iris.test"},
+					Message: &email.Message{},
+				})
+				assert.NoError(t, err)
+			}()
+		}
+
+		wg.Wait()
+		assert.NotNil(t, c.LastSentEmail)
+	})
 }
 
 type FakeSmtpClient struct {
@@ -135,7 +245,8 @@ func (c *FakeSmtpClient) Close() error {
 func TestPrintService(t *testing.T) {
 	sendOpts := &email.SendOptions{
 		From: "test-from",
-		To:   "test-to",
+		To:   []string{"test-to"},
+		Cc:   []string{"test-cc"},
 		Message: &email.Message{
 			Subject:  "test-subject",
 			TextBody: "test-text-body",
@@ -145,10 +256,13 @@ func TestPrintService(t *testing.T) {
 
 	b := &bytes.Buffer{}
 	s := email.NewPrintService(b)
-	err := s.Send(sendOpts)
+	_, err := s.Send(sendOpts)
 	assert.NoError(t, err)
 
 	out := b.String()
+	assert.Contains(t, out, "test-to")
+	assert.Contains(t, out, "test-cc")
+	assert.NotContains(t, out, "Bcc")
 	assert.Contains(t, out, sendOpts.Message.Subject)
 	assert.Contains(t, out, sendOpts.Message.TextBody)
 	assert.Contains(t, out, sendOpts.Message.HtmlBody)
@@ -159,9 +273,9 @@ func TestRateLimitedService(t *testing.T) {
 	s = email.ApplyOptions(s, email.WithRateLimit(1))
 	then := time.Now()
 	for i := 0; i < 5; i++ {
-		err := s.Send(&email.SendOptions{
+		_, err := s.Send(&email.SendOptions{
 			From:    "test-from",
-			To:      "test-to",
+			To:      []string{"test-to"},
 			Message: &email.Message{},
 		})
 		require.NoError(t, err)
@@ -207,31 +321,146 @@ func TestRetryService(t *testing.T) {
 	for _, test := range tt {
 		t.Run(test.name, func(t *testing.T) {
 			var s email.Service = &unreliableService{errorsBeforeSucceeding: test.errorCount}
-			s = email.ApplyOptions(s, email.WithRetries(test.retryCount))
-			err := s.Send(&email.SendOptions{
+			s = email.ApplyOptions(s, email.WithRetries(email.RetryPolicy{Retries: test.retryCount}))
+			result, err := s.Send(&email.SendOptions{
 				From:    "test-from",
-				To:      "test-to",
+				To:      []string{"test-to"},
 				Message: &email.Message{},
 			})
 			if test.wantErr {
 				assert.Error(t, err)
+				assert.Equal(t, test.retryCount+1, result.Attempts)
 			} else {
 				assert.NoError(t, err)
+				assert.Equal(t, test.errorCount+1, result.Attempts)
 			}
 		})
 	}
 }
 
+func TestRetryServiceBackoff(t *testing.T) {
+	t.Run("WithRetryableErrors", func(t *testing.T) {
+		var s email.Service = &unreliableService{errorsBeforeSucceeding: 3}
+		s = email.ApplyOptions(s, email.WithRetries(email.RetryPolicy{
+			Retries:   3,
+			BaseDelay: 20 * time.Millisecond,
+			MaxDelay:  30 * time.Millisecond,
+		}))
+
+		then := time.Now()
+		result, err := s.Send(&email.SendOptions{Message: &email.Message{}})
+		assert.NoError(t, err)
+		assert.Equal(t, 4, result.Attempts)
+
+		// 20ms + 30ms (capped 40ms) + 30ms (capped 80ms)
+		assert.GreaterOrEqual(t, time.Since(then), 80*time.Millisecond)
+	})
+
+	t.Run("WithoutMaxDelay", func(t *testing.T) {
+		var s email.Service = &unreliableService{errorsBeforeSucceeding: 3}
+		s = email.ApplyOptions(s, email.WithRetries(email.RetryPolicy{
+			Retries:   3,
+			BaseDelay: 10 * time.Millisecond,
+		}))
+
+		then := time.Now()
+		result, err := s.Send(&email.SendOptions{Message: &email.Message{}})
+		assert.NoError(t, err)
+		assert.Equal(t, 4, result.Attempts)
+
+		// 10ms + 20ms + 40ms
+		assert.GreaterOrEqual(t, time.Since(then), 70*time.Millisecond)
+	})
+
+	t.Run("WithInvalidAddress", func(t *testing.T) {
+		s := email.ApplyOptions(email.NewSmtpServiceWithClient(&FakeSmtpClient{}), email.WithRetries(email.RetryPolicy{
+			Retries:   3,
+			BaseDelay: time.Second,
+		}))
+
+		result, err := s.Send(&email.SendOptions{
+			From:    "from@iris.test",
+			To:      []string{"to@iris.test <invalid"},
+			Message: &email.Message{Subject: "test-subject", TextBody: "test-text-body"},
+		})
+		assert.Error(t, err)
+		assert.False(t, email.IsRetryableError(err))
+		assert.Equal(t, 1, result.Attempts)
+	})
+
+	t.Run("WithPermanentError", func(t *testing.T) {
+		var s email.Service = &unreliableService{errorsBeforeSucceeding: 3}
+		s = email.ApplyOptions(s, email.WithRetries(email.RetryPolicy{
+			Retries:     3,
+			IsRetryable: func(err error) bool { return false },
+		}))
+
+		result, err := s.Send(&email.SendOptions{Message: &email.Message{}})
+		assert.Error(t, err)
+		assert.Equal(t, 1, result.Attempts)
+	})
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tt := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "WithAwsThrottling",
+			err:  awserr.New("Throttling", "test-error", nil),
+			want: true,
+		},
+		{
+			name: "WithAwsServerError",
+			err:  awserr.NewRequestFailure(awserr.New("InternalFailure", "test-error", nil), 500, "test-id"),
+			want: true,
+		},
+		{
+			name: "WithAwsMessageRejected",
+			err:  awserr.New(ses.ErrCodeMessageRejected, "test-error", nil),
+			want: false,
+		},
+		{
+			name: "WithSmtpTransientReply",
+			err:  &textproto.Error{Code: 421, Msg: "test-error"},
+			want: true,
+		},
+		{
+			name: "WithSmtpPermanentReply",
+			err:  &textproto.Error{Code: 550, Msg: "test-error"},
+			want: false,
+		},
+		{
+			name: "WithWrappedError",
+			err:  fmt.Errorf("failed to send email: %w", &textproto.Error{Code: 550, Msg: "test-error"}),
+			want: false,
+		},
+		{
+			name: "WithUnknownError",
+			err:  fmt.Errorf("test-error"),
+			want: true,
+		},
+	}
+
+	for _, test := range tt {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, email.IsRetryableError(test.err))
+		})
+	}
+}
+
 type unreliableService struct {
 	errorsBeforeSucceeding int
 }
 
-func (s *unreliableService) Send(opts *email.SendOptions) error {
+func (s *unreliableService) Send(opts *email.SendOptions) (*email.SendResult, error) {
 	s.errorsBeforeSucceeding--
 	if s.errorsBeforeSucceeding > -1 {
-		return fmt.Errorf("test-error")
+		return nil, fmt.Errorf("test-error")
 	}
-	return nil
+	return &email.SendResult{}, nil
 }
 
 func (s *unreliableService) Close() error {
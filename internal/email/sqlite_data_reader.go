@@ -0,0 +1,112 @@
+package email
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/trynoice/iris/internal/config"
+	_ "modernc.org/sqlite"
+)
+
+// newSqliteDataReader runs the query of the given source on its sqlite database
+// and reads each resulting row as the recipient data, using the column names as
+// the keys.
+func newSqliteDataReader(dir string, src *config.RecipientSourceConfig, defaultValues map[string]string) (DataReader, error) {
+	if src.Database == "" || src.Query == "" {
+		return nil, fmt.Errorf("sqlite recipient source must include a database and a query")
+	}
+
+	name := src.Database
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+
+	// opening a missing database creates an empty one instead of failing.
+	if _, err := os.Stat(name); err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	dsn := "file:" + (&url.URL{Path: filepath.ToSlash(name)}).EscapedPath() + "?mode=ro"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	rows, err := db.Query(src.Query)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to query sqlite database: %w", err)
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		db.Close()
+		return nil, fmt.Errorf("failed to read columns from sqlite database: %w", err)
+	}
+
+	return &sqliteDataReader{
+		mutex:         sync.Mutex{},
+		defaultValues: defaultValues,
+		db:            db,
+		rows:          rows,
+		columns:       columns,
+	}, nil
+}
+
+type sqliteDataReader struct {
+	mutex         sync.Mutex
+	defaultValues map[string]string
+	db            *sql.DB
+	rows          *sql.Rows
+	columns       []string
+}
+
+func (r *sqliteDataReader) Read() (any, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read record from sqlite database: %w", err)
+		}
+
+		return nil, io.EOF
+	}
+
+	values := make([]any, len(r.columns))
+	pointers := make([]any, len(r.columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	if err := r.rows.Scan(pointers...); err != nil {
+		return nil, fmt.Errorf("failed to read record from sqlite database: %w", err)
+	}
+
+	row := make(map[string]any, len(r.columns))
+	for i, column := range r.columns {
+		switch v := values[i].(type) {
+		case []byte:
+			row[column] = string(v)
+		case nil:
+			// the templates print `<no value>` for nil values.
+			row[column] = ""
+		default:
+			row[column] = v
+		}
+	}
+
+	mergeDefaultValues(row, r.defaultValues)
+	return row, nil
+}
+
+func (r *sqliteDataReader) Close() error {
+	r.rows.Close()
+	return r.db.Close()
+}
@@ -0,0 +1,258 @@
+package email
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func NewSuppressionList() *SuppressionList {
+	return &SuppressionList{
+		addresses:       map[string]bool{},
+		domains:         map[string]bool{},
+		wildcardDomains: map[string]bool{},
+	}
+}
+
+// SuppressionList matches the addresses that must not receive any emails, e.g.
+// the addresses that bounced or unsubscribed before. Its entries are addresses,
+// e.g. `jack@example.test`, domains, e.g. `example.test` or `@example.test`, and
+// wildcard domains that match all subdomains of a domain, e.g.
+// `*.example.test`. It matches the entries case-insensitively.
+type SuppressionList struct {
+	addresses       map[string]bool
+	domains         map[string]bool
+	wildcardDomains map[string]bool
+}
+
+// Add adds the given entry to the list.
+func (l *SuppressionList) Add(entry string) error {
+	entry, err := normalizeSuppression(entry)
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(entry, "@") {
+		l.addresses[entry] = true
+	} else if domain := strings.TrimPrefix(entry, "*."); domain != entry {
+		l.wildcardDomains[domain] = true
+	} else {
+		l.domains[entry] = true
+	}
+
+	return nil
+}
+
+// Load adds the entries in the given file to the list. It reads the first column
+// of each row in csv files, ignoring an invalid first row, e.g. a header, and
+// each line in the other files, ignoring the blank lines and the lines starting
+// with `#`.
+func (l *SuppressionList) Load(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open suppression file: %w", err)
+	}
+
+	defer file.Close()
+	isCsv := strings.EqualFold(filepath.Ext(name), ".csv")
+	entries, err := readSuppressions(file, isCsv)
+	if err != nil {
+		return fmt.Errorf("failed to read suppression file %s: %w", name, err)
+	}
+
+	for i, entry := range entries {
+		if err := l.Add(entry); err != nil && !(isCsv && i == 0) {
+			return fmt.Errorf("failed to read suppression file %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// IsSuppressed reports whether the given address matches an entry in the list.
+func (l *SuppressionList) IsSuppressed(address string) bool {
+	if a, err := netmail.ParseAddress(address); err == nil {
+		address = a.Address
+	}
+
+	address = strings.ToLower(strings.TrimSpace(address))
+	if l.addresses[address] {
+		return true
+	}
+
+	i := strings.LastIndex(address, "@")
+	if i < 0 {
+		return false
+	}
+
+	domain := address[i+1:]
+	if l.domains[domain] {
+		return true
+	}
+
+	for i := strings.Index(domain, "."); i >= 0; i = strings.Index(domain, ".") {
+		if domain = domain[i+1:]; l.wildcardDomains[domain] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeSuppression validates the given suppression entry and returns it in
+// lowercase, without the display name of the addresses and the `@` prefix of
+// the domains.
+func normalizeSuppression(entry string) (string, error) {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	if domain := strings.TrimPrefix(entry, "@"); domain != entry {
+		entry = domain
+	} else if strings.Contains(entry, "@") {
+		a, err := netmail.ParseAddress(entry)
+		if err != nil {
+			return "", fmt.Errorf("invalid suppression address %q: %w", entry, err)
+		}
+
+		return strings.ToLower(a.Address), nil
+	}
+
+	domain := strings.TrimPrefix(entry, "*.")
+	if !strings.Contains(domain, ".") || strings.ContainsAny(domain, " *@") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", fmt.Errorf("invalid suppression domain %q", entry)
+	}
+
+	return entry, nil
+}
+
+func readSuppressions(r io.Reader, isCsv bool) ([]string, error) {
+	entries := []string{}
+	if isCsv {
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.Comment = '#'
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			if len(row) > 0 && strings.TrimSpace(row[0]) != "" {
+				entries = append(entries, row[0])
+			}
+		}
+
+		return entries, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// OpenSuppressionStore reads the suppression store in the given file. The file
+// needn't exist until the store is saved.
+func OpenSuppressionStore(name string) (*SuppressionStore, error) {
+	s := &SuppressionStore{file: name, entries: map[string]bool{}}
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open suppression store: %w", err)
+	}
+
+	defer file.Close()
+	entries, err := readSuppressions(file, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suppression store: %w", err)
+	}
+
+	for _, entry := range entries {
+		s.entries[entry] = true
+	}
+
+	return s, nil
+}
+
+// SuppressionStore is a local file of suppression entries that applies to all
+// send runs.
+type SuppressionStore struct {
+	file    string
+	entries map[string]bool
+}
+
+// Add adds the given entry to the store. It reports whether the store didn't
+// contain the entry.
+func (s *SuppressionStore) Add(entry string) (bool, error) {
+	entry, err := normalizeSuppression(entry)
+	if err != nil {
+		return false, err
+	}
+
+	added := !s.entries[entry]
+	s.entries[entry] = true
+	return added, nil
+}
+
+// Remove removes the given entry from the store. It reports whether the store
+// contained the entry.
+func (s *SuppressionStore) Remove(entry string) (bool, error) {
+	entry, err := normalizeSuppression(entry)
+	if err != nil {
+		return false, err
+	}
+
+	removed := s.entries[entry]
+	delete(s.entries, entry)
+	return removed, nil
+}
+
+// Entries returns the sorted entries in the store.
+func (s *SuppressionStore) Entries() []string {
+	entries := make([]string, 0, len(s.entries))
+	for entry := range s.entries {
+		entries = append(entries, entry)
+	}
+
+	sort.Strings(entries)
+	return entries
+}
+
+// Save writes the entries to the file of the store.
+func (s *SuppressionStore) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.file), os.ModeDir|os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create suppression store directory: %w", err)
+	}
+
+	content := strings.Builder{}
+	for _, entry := range s.Entries() {
+		content.WriteString(entry)
+		content.WriteString("\n")
+	}
+
+	if err := os.WriteFile(s.file, []byte(content.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write suppression store: %w", err)
+	}
+
+	return nil
+}
+
+// AddTo adds the entries in the store to the given suppression list.
+func (s *SuppressionStore) AddTo(l *SuppressionList) error {
+	for entry := range s.entries {
+		if err := l.Add(entry); err != nil {
+			return fmt.Errorf("failed to read suppression store: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package email_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trynoice/iris/internal/email"
+	"github.com/trynoice/iris/internal/testutil"
+)
+
+func TestSuppressionList(t *testing.T) {
+	t.Run("IsSuppressed", func(t *testing.T) {
+		l := email.NewSuppressionList()
+		for _, entry := range []string{"Jack@Iris.test", "@blocked.test", "spam.test", "*.Wild.test"} {
+			require.NoError(t, l.Add(entry))
+		}
+
+		for _, test := range []struct {
+			address string
+			want    bool
+		}{
+			{address: "jack@iris.test", want: true},
+			{address: "Jack <JACK@IRIS.TEST>", want: true},
+			{address: "jill@iris.test", want: false},
+			{address: "jill@blocked.test", want: true},
+			{address: "jill@sub.blocked.test", want: false},
+			{address: "jill@spam.test", want: true},
+			{address: "jill@mail.wild.test", want: true},
+			{address: "jill@a.b.wild.test", want: true},
+			{address: "jill@wild.test", want: false},
+			{address: "jill@notwild.test", want: false},
+		} {
+			assert.Equal(t, test.want, l.IsSuppressed(test.address), test.address)
+		}
+	})
+
+	t.Run("WithInvalidEntries", func(t *testing.T) {
+		l := email.NewSuppressionList()
+		for _, entry := range []string{"", "jack@", "localhost", "*.", "*.*.iris.test", "iris .test"} {
+			assert.Error(t, l.Add(entry), entry)
+		}
+	})
+
+	t.Run("Load", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, "bounces.csv", "email,reason\njack@iris.test,bounce\n\n*.wild.test,spam")
+		testutil.CreateFile(t, tmpDir, "unsubscribed.txt", "# unsubscribed\n\njill@iris.test\n  blocked.test  \n")
+		testutil.CreateFile(t, tmpDir, "invalid.txt", "email\njack@iris.test")
+
+		l := email.NewSuppressionList()
+		require.NoError(t, l.Load(filepath.Join(tmpDir, "bounces.csv")))
+		require.NoError(t, l.Load(filepath.Join(tmpDir, "unsubscribed.txt")))
+		assert.True(t, l.IsSuppressed("jack@iris.test"))
+		assert.True(t, l.IsSuppressed("jack@mail.wild.test"))
+		assert.True(t, l.IsSuppressed("jill@iris.test"))
+		assert.True(t, l.IsSuppressed("jack@blocked.test"))
+		assert.False(t, l.IsSuppressed("email@iris.test"))
+
+		assert.Error(t, l.Load(filepath.Join(tmpDir, "invalid.txt")))
+		assert.Error(t, l.Load(filepath.Join(tmpDir, "missing.txt")))
+	})
+}
+
+func TestSuppressionStore(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "iris", "suppressions.txt")
+	s, err := email.OpenSuppressionStore(name)
+	require.NoError(t, err)
+	assert.Empty(t, s.Entries())
+
+	added, err := s.Add("Jack@Iris.test")
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	added, err = s.Add("jack@iris.test")
+	assert.NoError(t, err)
+	assert.False(t, added)
+
+	added, err = s.Add("*.wild.test")
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	_, err = s.Add("jack@")
+	assert.Error(t, err)
+	require.NoError(t, s.Save())
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, "*.wild.test\njack@iris.test\n", string(data))
+
+	s, err = email.OpenSuppressionStore(name)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*.wild.test", "jack@iris.test"}, s.Entries())
+
+	removed, err := s.Remove("JACK@iris.test")
+	assert.NoError(t, err)
+	assert.True(t, removed)
+
+	removed, err = s.Remove("jill@iris.test")
+	assert.NoError(t, err)
+	assert.False(t, removed)
+
+	l := email.NewSuppressionList()
+	require.NoError(t, s.AddTo(l))
+	assert.False(t, l.IsSuppressed("jack@iris.test"))
+	assert.True(t, l.IsSuppressed("jack@mail.wild.test"))
+}
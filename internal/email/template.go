@@ -2,80 +2,859 @@ package email
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	htmltemplate "html/template"
+	"net/textproto"
+	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
 	"text/template"
+	"text/template/parse"
 
 	"github.com/tdewolff/minify/v2"
 	"github.com/tdewolff/minify/v2/html"
+	"github.com/trynoice/iris/internal/config"
 )
 
 const (
-	subjectFile  = "subject.txt"
-	textBodyFile = "body.txt"
-	htmlBodyFile = "body.html"
+	subjectFile      = "subject.txt"
+	textBodyFile     = "body.txt"
+	htmlBodyFile     = "body.html"
+	markdownBodyFile = "body.md"
+
+	// LayoutFile is the layout in the partials directory that wraps the html
+	// converted from the markdown body. It must render a `content` block.
+	LayoutFile = "layout.html"
+
+	headerTemplatePrefix = "header:"
 )
 
-func NewTemplate(dir string, minifyHtml bool) (*Template, error) {
-	template, err := template.ParseFiles(
-		filepath.Join(dir, subjectFile),
-		filepath.Join(dir, textBodyFile),
-		filepath.Join(dir, htmlBodyFile),
-	)
+// cidPattern matches the content id references, e.g. `cid:logo.png`, in the
+// html templates and the rendered html body.
+var cidPattern = regexp.MustCompile(`cid:([^"'\s<>)]+)`)
+
+// missingKeyPattern extracts the key from the errors that `text/template`
+// returns for the missing map keys with the `missingkey=error` option.
+var missingKeyPattern = regexp.MustCompile(`map has no entry for key "([^"]*)"`)
+
+// missingKeyPolicies maps the missing key policies to `text/template` options.
+var missingKeyPolicies = map[string]string{
+	"":        "missingkey=default",
+	"default": "missingkey=default",
+	"zero":    "missingkey=zero",
+	"error":   "missingkey=error",
+}
+
+// variantFilePattern matches the template files of the variants, e.g.
+// `body.de.html`, and captures the variant.
+var variantFilePattern = regexp.MustCompile(`^(?:subject|body)\.([^.]+)\.(?:txt|html|md)$`)
+
+// reservedHeaders are managed by the email services and can't be overridden by
+// the custom headers.
+var reservedHeaders = []string{
+	"Bcc", "Cc", "Content-Transfer-Encoding", "Content-Type", "Date", "From",
+	"Message-Id", "Mime-Version", "Reply-To", "Subject", "To",
+}
+
+// MissingKeyError reports a key that a template references, but the recipient
+// data doesn't contain.
+type MissingKeyError struct {
+	File string
+	Key  string
+	Err  error
+}
+
+func (e *MissingKeyError) Error() string {
+	return fmt.Sprintf("%s references missing key %q", e.File, e.Key)
+}
+
+func (e *MissingKeyError) Unwrap() error {
+	return e.Err
+}
+
+func NewTemplate(dir string, cfg *config.MessageConfig) (*Template, error) {
+	missingKeyOption, ok := missingKeyPolicies[cfg.MissingKeyPolicy]
+	if !ok {
+		return nil, fmt.Errorf("invalid missing key policy %q", cfg.MissingKeyPolicy)
+	}
+
+	t := &Template{
+		mutex:        sync.Mutex{},
+		missingKey:   missingKeyOption,
+		dir:          dir,
+		buffer:       &bytes.Buffer{},
+		inlineImages: map[string]*Attachment{},
+		rawHtmlKeys:  map[string]bool{},
+		inlineCss:    cfg.InlineCss,
+		localeKey:    cfg.LocaleColumnName,
+		locales:      map[string]*templateSet{},
+		addressKey:   cfg.RecipientEmailColumnName,
+		variantSeed:  cfg.VariantSeed,
+	}
+
+	for _, key := range cfg.RawHtmlColumnNames {
+		t.rawHtmlKeys[key] = true
+	}
+
+	headers := map[string]string{}
+	for name, value := range cfg.Headers {
+		headers[textproto.CanonicalMIMEHeaderKey(name)] = value
+	}
+
+	if cfg.ListUnsubscribe != "" {
+		headers["List-Unsubscribe"] = cfg.ListUnsubscribe
+		if cfg.ListUnsubscribeOneClick {
+			headers["List-Unsubscribe-Post"] = "List-Unsubscribe=One-Click"
+		}
+	} else if cfg.ListUnsubscribeOneClick {
+		return nil, fmt.Errorf("one-click unsubscribe requires a list-unsubscribe header")
+	}
+
+	for name := range headers {
+		for _, reserved := range reservedHeaders {
+			if name == reserved {
+				return nil, fmt.Errorf("header %s can't be customised", name)
+			}
+		}
+
+		t.headerNames = append(t.headerNames, name)
+	}
+
+	sort.Strings(t.headerNames)
+	textPartials, htmlPartials, err := findPartials(dir, cfg.PartialsDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse email templates: %w", err)
+		return nil, err
+	}
+
+	parse := func(variant string, fallback *templateSet) (*templateSet, error) {
+		s, err := t.parseTemplateSet(variant, fallback, textPartials, htmlPartials, headers)
+		if err != nil {
+			return nil, err
+		}
+
+		s.text.Option(missingKeyOption)
+		s.html.Option(missingKeyOption)
+		s.printedKeys = findPrintedKeys(s)
+		return s, nil
+	}
+
+	if cfg.LocaleColumnName != "" {
+		locales, err := findVariants(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, locale := range locales {
+			if t.locales[normalizeLocale(locale)], err = parse(locale, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// use the templates without a locale if the default locale doesn't have
+	// its own templates.
+	defaultLocale := normalizeLocale(cfg.DefaultLocale)
+	if t.fallback = t.locales[defaultLocale]; t.fallback == nil {
+		if t.fallback, err = parse("", nil); err != nil {
+			return nil, err
+		}
+
+		if defaultLocale != "" {
+			t.locales[defaultLocale] = t.fallback
+		}
+	}
+
+	if len(cfg.Variants) > 0 && cfg.LocaleColumnName != "" {
+		return nil, fmt.Errorf("variants can't be used along with locales")
 	}
 
-	var m *minify.M
-	if minifyHtml {
-		m = minify.New()
-		m.Add("text/html", &html.Minifier{
+	names := map[string]bool{}
+	for _, v := range cfg.Variants {
+		if v.Name == "" || strings.ContainsAny(v.Name, "./\\") {
+			return nil, fmt.Errorf("invalid variant name %q", v.Name)
+		} else if names[v.Name] {
+			return nil, fmt.Errorf("duplicate variant %q", v.Name)
+		} else if v.Weight <= 0 {
+			return nil, fmt.Errorf("variant %q must have a positive weight", v.Name)
+		}
+
+		// the variants fall back to the templates without a variant, e.g. to
+		// test the subjects with the same body.
+		s, err := parse(v.Name, t.fallback)
+		if err != nil {
+			return nil, err
+		}
+
+		names[v.Name] = true
+		t.variants = append(t.variants, &variant{name: v.Name, weight: v.Weight, set: s})
+		t.totalVariantWeight += v.Weight
+	}
+
+	if cfg.MinifyHtml {
+		t.htmlMinifier = minify.New()
+		t.htmlMinifier.Add("text/html", &html.Minifier{
 			KeepDocumentTags: true,
 			KeepEndTags:      true,
+			// email clients need quoted `cid:` references to find inline images.
+			KeepQuotes: true,
 		})
 	}
 
-	return &Template{
-		mutex:        sync.Mutex{},
-		template:     template,
-		buffer:       &bytes.Buffer{},
-		htmlMinifier: m,
-	}, nil
+	return t, nil
+}
+
+// findPartials returns the paths of the text (`*.txt`) and html (`*.html`)
+// partial templates in the given partials directory. A relative partials
+// directory is resolved against the working directory.
+func findPartials(dir string, partialsDir string) ([]string, []string, error) {
+	if partialsDir == "" {
+		return nil, nil, nil
+	}
+
+	if !filepath.IsAbs(partialsDir) {
+		partialsDir = filepath.Join(dir, partialsDir)
+	}
+
+	if info, err := os.Stat(partialsDir); err != nil {
+		return nil, nil, fmt.Errorf("failed to read partials directory: %w", err)
+	} else if !info.IsDir() {
+		return nil, nil, fmt.Errorf("partials directory %s is not a directory", partialsDir)
+	}
+
+	// the patterns are well-formed, so `Glob` can't return an error.
+	textPartials, _ := filepath.Glob(filepath.Join(partialsDir, "*.txt"))
+	htmlPartials, _ := filepath.Glob(filepath.Join(partialsDir, "*.html"))
+	return textPartials, htmlPartials, nil
+}
+
+// parseTemplateSet parses the email templates of the given variant, along with
+// the partials and the header templates. If `fallback` isn't nil, the variant
+// uses its subject if the variant has no subject, and its bodies if the variant
+// has no bodies.
+func (t *Template) parseTemplateSet(variant string, fallback *templateSet, textPartials []string, htmlPartials []string, headers map[string]string) (*templateSet, error) {
+	s := &templateSet{subjectFile: variantFile(subjectFile, variant)}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(t.dir, name))
+		return err == nil
+	}
+
+	if fallback != nil && !exists(s.subjectFile) {
+		s.subjectFile = fallback.subjectFile
+	}
+
+	if mdFile := variantFile(markdownBodyFile, variant); exists(mdFile) {
+		for _, f := range []string{variantFile(textBodyFile, variant), variantFile(htmlBodyFile, variant)} {
+			if exists(f) {
+				return nil, fmt.Errorf("%s can't be used along with %s", mdFile, f)
+			}
+		}
+
+		s.bodyFile = mdFile
+		s.htmlBodyFile = variantFile(htmlBodyFile, variant)
+	} else {
+		if f := variantFile(textBodyFile, variant); exists(f) {
+			s.bodyFile = f
+		}
+
+		if f := variantFile(htmlBodyFile, variant); exists(f) {
+			s.htmlBodyFile = f
+		}
+
+		if s.bodyFile == "" && s.htmlBodyFile == "" && fallback != nil {
+			s.bodyFile, s.htmlBodyFile = fallback.bodyFile, fallback.htmlBodyFile
+		} else if s.bodyFile == "" && s.htmlBodyFile == "" {
+			return nil, fmt.Errorf(
+				"email templates must include %s, %s or %s",
+				variantFile(textBodyFile, variant),
+				variantFile(htmlBodyFile, variant),
+				mdFile,
+			)
+		}
+	}
+
+	// parse the partials before the email templates so that the templates can
+	// override the blocks defined by the partials.
+	textFiles := append(append([]string{}, textPartials...), filepath.Join(t.dir, s.subjectFile))
+	if s.bodyFile != "" {
+		textFiles = append(textFiles, filepath.Join(t.dir, s.bodyFile))
+	}
+
+	var err error
+	s.text, err = template.New("").
+		Funcs(templateFuncs()).
+		Funcs(template.FuncMap{"embed": t.embed}).
+		ParseFiles(textFiles...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email templates: %w", err)
+	}
+
+	htmlFiles := append([]string{}, htmlPartials...)
+	if s.isMarkdown() {
+		htmlFiles = append(htmlFiles, filepath.Join(t.dir, s.bodyFile))
+	} else if s.htmlBodyFile != "" {
+		htmlFiles = append(htmlFiles, filepath.Join(t.dir, s.htmlBodyFile))
+	}
+
+	if s.cids, err = findCids(htmlFiles); err != nil {
+		return nil, err
+	}
+
+	for name, value := range headers {
+		if _, err := s.text.New(headerTemplatePrefix + name).Parse(value); err != nil {
+			return nil, fmt.Errorf("failed to parse %s header template: %w", name, err)
+		}
+	}
+
+	// the html body uses `html/template` to escape the recipient data according
+	// to its context in the html document.
+	s.html = htmltemplate.New("").
+		Funcs(templateFuncs()).
+		Funcs(htmltemplate.FuncMap{
+			"embed":        t.embedHtml,
+			"markdownHtml": t.markdownHtml,
+		})
+
+	if len(htmlPartials) > 0 {
+		if _, err := s.html.ParseFiles(htmlPartials...); err != nil {
+			return nil, fmt.Errorf("failed to parse email templates: %w", err)
+		}
+	}
+
+	if s.isMarkdown() {
+		// the html converted from the markdown body doesn't need escaping, since
+		// the markdown converter escapes the text and omits the raw html.
+		body := "{{ markdownHtml }}"
+		if s.html.Lookup(LayoutFile) != nil {
+			body = `{{ template "` + LayoutFile + `" . }}{{ define "content" }}{{ markdownHtml }}{{ end }}`
+		}
+
+		_, err = s.html.New(s.htmlBodyFile).Parse(body)
+	} else if s.htmlBodyFile != "" {
+		_, err = s.html.ParseFiles(filepath.Join(t.dir, s.htmlBodyFile))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email templates: %w", err)
+	}
+
+	return s, nil
+}
+
+// findCids returns the inline images referenced by `cid:` urls in the given
+// template files.
+func findCids(files []string) (map[string]bool, error) {
+	cids := map[string]bool{}
+	for _, f := range files {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read email template: %w", err)
+		}
+
+		for _, match := range cidPattern.FindAllStringSubmatch(string(content), -1) {
+			cids[match[1]] = true
+		}
+	}
+
+	return cids, nil
+}
+
+// findVariants returns the sorted variants that have their own template files
+// in the given directory.
+func findVariants(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email templates: %w", err)
+	}
+
+	variants := []string{}
+	seen := map[string]bool{}
+	for _, e := range entries {
+		match := variantFilePattern.FindStringSubmatch(e.Name())
+		if match == nil || seen[match[1]] {
+			continue
+		}
+
+		seen[match[1]] = true
+		variants = append(variants, match[1])
+	}
+
+	sort.Strings(variants)
+	return variants, nil
+}
+
+// variantFile returns the name of the given template file for a variant, e.g.
+// `subject.de.txt` for the `de` variant of `subject.txt`.
+func variantFile(name string, variant string) string {
+	if variant == "" {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + variant + ext
+}
+
+// normalizeLocale returns the lowercase locale with hyphens as separators, e.g.
+// `pt-br` for `pt_BR`.
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// withValue returns a copy of the given recipient data with the given value
+// for the key.
+func withValue(data any, key string, value string) any {
+	switch data := data.(type) {
+	case map[string]string:
+		d := make(map[string]string, len(data)+1)
+		for k, v := range data {
+			d[k] = v
+		}
+
+		d[key] = value
+		return d
+	case map[string]any:
+		d := make(map[string]any, len(data)+1)
+		for k, v := range data {
+			d[k] = v
+		}
+
+		d[key] = value
+		return d
+	}
+
+	return data
+}
+
+// emptyValues returns a copy of the given structured recipient data, e.g. from
+// json or sqlite, replacing the nil values of the given keys, and also their
+// missing values if `missing` is true, with empty strings. Otherwise, the
+// templates print `<no value>` for them, since `missingkey=zero` only applies to
+// the element type of the map, which is `any`. It applies the keys to the
+// nested objects too, as the templates may print them in `range` or `with`.
+func emptyValues(data any, keys map[string]bool, missing bool) any {
+	switch data := data.(type) {
+	case map[string]any:
+		d := make(map[string]any, len(data))
+		for k, v := range data {
+			d[k] = emptyValues(v, keys, missing)
+		}
+
+		for k := range keys {
+			if v, ok := d[k]; (ok && v == nil) || (!ok && missing) {
+				d[k] = ""
+			}
+		}
+
+		return d
+	case []any:
+		d := make([]any, len(data))
+		for i, v := range data {
+			d[i] = emptyValues(v, keys, missing)
+		}
+
+		return d
+	}
+
+	return data
+}
+
+// findPrintedKeys returns the keys whose values the templates of the given set
+// print. It ignores the keys in the pipelines of `if`, `range` and `with`, so
+// that replacing their missing values doesn't change what they do.
+func findPrintedKeys(s *templateSet) map[string]bool {
+	keys := map[string]bool{}
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n != nil {
+				for _, c := range n.Nodes {
+					walk(c)
+				}
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			for _, c := range n.Cmds {
+				for _, arg := range c.Args {
+					walk(arg)
+				}
+			}
+		case *parse.FieldNode:
+			keys[n.Ident[len(n.Ident)-1]] = true
+		case *parse.VariableNode:
+			if len(n.Ident) > 1 {
+				keys[n.Ident[len(n.Ident)-1]] = true
+			}
+		case *parse.ChainNode:
+			if len(n.Field) > 0 {
+				keys[n.Field[len(n.Field)-1]] = true
+			}
+		case *parse.IfNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+
+	for _, tmpl := range s.text.Templates() {
+		if tmpl.Tree != nil {
+			walk(tmpl.Tree.Root)
+		}
+	}
+
+	for _, tmpl := range s.html.Templates() {
+		if tmpl.Tree != nil {
+			walk(tmpl.Tree.Root)
+		}
+	}
+
+	return keys
+}
+
+// variant is a weighted set of email templates for A/B testing.
+type variant struct {
+	name   string
+	weight int
+	set    *templateSet
+}
+
+// templateSet is the set of email templates for a variant, e.g. a locale.
+type templateSet struct {
+	subjectFile  string
+	bodyFile     string // renders the text or markdown body, if any.
+	htmlBodyFile string // renders the html body, if any.
+	// cids are the inline images referenced by `cid:` urls in the template
+	// sources, excluding the ones in the recipient data.
+	cids map[string]bool
+	// printedKeys are the keys whose values the templates print, e.g. `Name` in
+	// `{{ .Name }}`.
+	printedKeys map[string]bool
+	text        *template.Template
+	html        *htmltemplate.Template
+}
+
+// isMarkdown reports whether the text and html bodies are generated from the
+// markdown body.
+func (s *templateSet) isMarkdown() bool {
+	return strings.HasSuffix(s.bodyFile, filepath.Ext(markdownBodyFile))
 }
 
 type Template struct {
-	mutex        sync.Mutex
-	template     *template.Template
-	buffer       *bytes.Buffer
-	htmlMinifier *minify.M
+	mutex              sync.Mutex
+	dir                string
+	missingKey         string // the `missingkey` option of the templates.
+	locales            map[string]*templateSet
+	fallback           *templateSet
+	localeKey          string
+	addressKey         string
+	variantSeed        string
+	variants           []*variant
+	totalVariantWeight int
+	rawHtmlKeys        map[string]bool
+	markdownHtmlBody   string
+	buffer             *bytes.Buffer
+	inlineCss          bool
+	htmlMinifier       *minify.M
+	inlineImages       map[string]*Attachment
+	embeddedImages     map[string]bool // the images embedded by the current render.
+	headerNames        []string
+}
+
+// Option sets options for rendering the templates, e.g. `missingkey=error`. See
+// `text/template.Template.Option` for the available options.
+func (t *Template) Option(opt ...string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	sets := append(t.templateSets(), t.fallback)
+	for _, v := range t.variants {
+		sets = append(sets, v.set)
+	}
+
+	for _, s := range sets {
+		s.text.Option(opt...)
+		s.html.Option(opt...)
+	}
+
+	for _, o := range opt {
+		if strings.HasPrefix(o, "missingkey=") {
+			t.missingKey = o
+		}
+	}
+}
+
+// HasLocale reports whether the given locale has its own templates, instead of
+// falling back to the templates of the default locale.
+func (t *Template) HasLocale(locale string) bool {
+	return t.localeTemplateSet(locale) != nil
+}
+
+// assignVariant deterministically assigns a variant to the given address by
+// hashing it with the variant seed. Each variant receives a share of the
+// addresses proportional to its weight.
+func (t *Template) assignVariant(address string) *variant {
+	h := fnv.New64a()
+	h.Write([]byte(t.variantSeed))
+	h.Write([]byte{0})
+	h.Write([]byte(strings.ToLower(strings.TrimSpace(address))))
+	n := int(h.Sum64() % uint64(t.totalVariantWeight))
+	for _, v := range t.variants {
+		if n < v.weight {
+			return v
+		}
+
+		n -= v.weight
+	}
+
+	return t.variants[len(t.variants)-1]
+}
+
+func (t *Template) templateSets() []*templateSet {
+	sets := make([]*templateSet, 0, len(t.locales))
+	for _, s := range t.locales {
+		sets = append(sets, s)
+	}
+
+	return sets
+}
+
+// localeTemplateSet returns the templates for the given locale, or for its
+// language if the locale has a region, e.g. `de` for `de-AT`. It returns nil if
+// neither has templates.
+func (t *Template) localeTemplateSet(locale string) *templateSet {
+	locale = normalizeLocale(locale)
+	if s, ok := t.locales[locale]; ok {
+		return s
+	}
+
+	if language, _, ok := strings.Cut(locale, "-"); ok {
+		return t.locales[language]
+	}
+
+	return nil
+}
+
+// markdownHtml is a template function that returns the html converted from the
+// markdown body of the current render.
+func (t *Template) markdownHtml() htmltemplate.HTML {
+	return htmltemplate.HTML(t.markdownHtmlBody)
+}
+
+func (t *Template) hasHeader(name string) bool {
+	i := sort.SearchStrings(t.headerNames, name)
+	return i < len(t.headerNames) && t.headerNames[i] == name
+}
+
+// embed is a template function that references the file at the given path,
+// relative to the working directory, as an inline image.
+func (t *Template) embed(path string) (string, error) {
+	if _, err := t.loadInlineImage(path); err != nil {
+		return "", err
+	}
+
+	t.embeddedImages[path] = true
+	return "cid:" + path, nil
+}
+
+// embedHtml is the `html/template` variant of embed. It marks the `cid:` url as
+// safe, since `html/template` otherwise replaces the urls with unknown schemes.
+func (t *Template) embedHtml(path string) (htmltemplate.URL, error) {
+	url, err := t.embed(path)
+	return htmltemplate.URL(url), err
+}
+
+// htmlData returns a copy of the given recipient data, marking the values of
+// the trusted raw html keys as safe html so that `html/template` renders them
+// without escaping.
+func (t *Template) htmlData(data any) any {
+	if len(t.rawHtmlKeys) == 0 {
+		return data
+	}
+
+	switch data := data.(type) {
+	case map[string]string:
+		d := make(map[string]any, len(data))
+		for k, v := range data {
+			if t.rawHtmlKeys[k] {
+				d[k] = htmltemplate.HTML(v)
+			} else {
+				d[k] = v
+			}
+		}
+
+		return d
+	case map[string]any:
+		d := make(map[string]any, len(data))
+		for k, v := range data {
+			if s, ok := v.(string); ok && t.rawHtmlKeys[k] {
+				d[k] = htmltemplate.HTML(s)
+			} else {
+				d[k] = v
+			}
+		}
+
+		return d
+	}
+
+	return data
+}
+
+// loadInlineImage returns the inline image at the given path, relative to the
+// working directory, reading it only once across renders.
+func (t *Template) loadInlineImage(path string) (*Attachment, error) {
+	if a, ok := t.inlineImages[path]; ok {
+		return a, nil
+	}
+
+	if !filepath.IsLocal(path) {
+		return nil, fmt.Errorf("failed to embed %s: path must be inside the working directory", path)
+	}
+
+	a, err := LoadAttachment(t.dir, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed %s: %w", path, err)
+	}
+
+	// email clients match the `cid:` references using the attachment name.
+	a.Name = path
+	t.inlineImages[path] = a
+	return a, nil
+}
+
+// renderError wraps the error returned by rendering the named template,
+// reporting the missing keys as a MissingKeyError.
+func renderError(name string, err error) error {
+	var execErr template.ExecError
+	if errors.As(err, &execErr) {
+		if match := missingKeyPattern.FindStringSubmatch(execErr.Err.Error()); match != nil {
+			return &MissingKeyError{File: name, Key: match[1], Err: err}
+		}
+	}
+
+	return fmt.Errorf("failed to render %s: %w", name, err)
 }
 
 func (t *Template) Render(data any) (*Message, error) {
-	// needs mutex because a shared buffer is used for rendering templates.
-	// although never invoked in parallel, it is still a good practice.
+	// needs mutex because a shared buffer is used for rendering templates and
+	// multiple send workers render concurrently.
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
+	t.embeddedImages = map[string]bool{}
+	s := t.fallback
+	if t.localeKey != "" {
+		if ls := t.localeTemplateSet(StringValue(data, t.localeKey)); ls != nil {
+			s = ls
+		}
+	}
+
 	m := &Message{}
+	if len(t.variants) > 0 {
+		v := t.assignVariant(StringValue(data, t.addressKey))
+		s, m.Variant = v.set, v.name
+		data = withValue(data, "Variant", v.name)
+	}
+
+	data = emptyValues(data, s.printedKeys, t.missingKey == missingKeyPolicies["zero"])
+
 	t.buffer.Reset()
-	if err := t.template.ExecuteTemplate(t.buffer, subjectFile, data); err != nil {
-		return nil, fmt.Errorf("failed to render subject template: %w", err)
+	if err := s.text.ExecuteTemplate(t.buffer, s.subjectFile, data); err != nil {
+		return nil, renderError(s.subjectFile, err)
 	}
 
 	m.Subject = t.buffer.String()
-	t.buffer.Reset()
-	if err := t.template.ExecuteTemplate(t.buffer, textBodyFile, data); err != nil {
-		return nil, fmt.Errorf("failed to render text body template: %w", err)
+	for _, name := range t.headerNames {
+		t.buffer.Reset()
+		if err := s.text.ExecuteTemplate(t.buffer, headerTemplatePrefix+name, data); err != nil {
+			return nil, renderError(name+" header", err)
+		}
+
+		value := t.buffer.String()
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("rendered %s header must not contain line breaks", name)
+		}
+
+		if name == "List-Unsubscribe" && t.hasHeader("List-Unsubscribe-Post") && !strings.Contains(value, "<https://") {
+			return nil, fmt.Errorf("one-click unsubscribe requires an https url in the list-unsubscribe header")
+		}
+
+		if m.Headers == nil {
+			m.Headers = map[string]string{}
+		}
+
+		m.Headers[name] = value
+	}
+
+	if s.bodyFile != "" {
+		t.buffer.Reset()
+		if err := s.text.ExecuteTemplate(t.buffer, s.bodyFile, data); err != nil {
+			return nil, renderError(s.bodyFile, err)
+		}
+
+		m.TextBody = t.buffer.String()
+		if s.isMarkdown() {
+			var err error
+			t.markdownHtmlBody, err = markdownToHtml(t.buffer.Bytes())
+			if err != nil {
+				return nil, err
+			}
+
+			m.TextBody = markdownToText(t.buffer.Bytes())
+		}
+	}
+
+	if s.htmlBodyFile == "" {
+		return m, nil
 	}
 
-	m.TextBody = t.buffer.String()
 	t.buffer.Reset()
-	if err := t.template.ExecuteTemplate(t.buffer, htmlBodyFile, data); err != nil {
-		return nil, fmt.Errorf("failed to render html body template: %w", err)
+	if err := s.html.ExecuteTemplate(t.buffer, s.htmlBodyFile, t.htmlData(data)); err != nil {
+		return nil, renderError(s.htmlBodyFile, err)
 	}
 
 	m.HtmlBody = t.buffer.String()
+	if s.bodyFile == "" {
+		var err error
+		m.TextBody, err = htmlToText(m.HtmlBody)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// only attach the images referenced by the templates, since the recipient
+	// data may also contain `cid:` urls.
+	seen := map[string]bool{}
+	for _, match := range cidPattern.FindAllStringSubmatch(m.HtmlBody, -1) {
+		if seen[match[1]] || (!s.cids[match[1]] && !t.embeddedImages[match[1]]) {
+			continue
+		}
+
+		seen[match[1]] = true
+		a, err := t.loadInlineImage(match[1])
+		if err != nil {
+			return nil, err
+		}
+
+		m.InlineImages = append(m.InlineImages, a)
+	}
+
+	if t.inlineCss {
+		var err error
+		m.HtmlBody, err = inlineStyles(m.HtmlBody)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if t.htmlMinifier != nil {
 		var err error
 		m.HtmlBody, err = t.htmlMinifier.String("text/html", m.HtmlBody)
@@ -83,5 +862,6 @@ func (t *Template) Render(data any) (*Message, error) {
 			return nil, fmt.Errorf("failed to minify html body: %w", err)
 		}
 	}
+
 	return m, nil
 }
@@ -1,9 +1,12 @@
 package email
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/trynoice/iris/internal/config"
 	"github.com/trynoice/iris/internal/testutil"
 )
 
@@ -21,7 +24,7 @@ func TestTemplate(t *testing.T) {
 		testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
 		testutil.CreateFile(t, tmpDir, htmlBodyFile, htmlBody)
 
-		template, err := NewTemplate(tmpDir, false)
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{})
 		assert.Error(t, err)
 		assert.Nil(t, template)
 	})
@@ -31,17 +34,34 @@ func TestTemplate(t *testing.T) {
 		testutil.CreateFile(t, tmpDir, subjectFile, subject)
 		testutil.CreateFile(t, tmpDir, htmlBodyFile, htmlBody)
 
-		template, err := NewTemplate(tmpDir, false)
-		assert.Error(t, err)
-		assert.Nil(t, template)
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{MinifyHtml: true})
+		assert.NoError(t, err)
+
+		m, err := template.Render(map[string]string{"data": "test-data"})
+		assert.NoError(t, err)
+		assert.Equal(t, "test-html-body test-data", m.TextBody)
+		assert.Contains(t, m.HtmlBody, "test-html-body test-data")
 	})
 
 	t.Run("WithoutHtmlBody", func(t *testing.T) {
 		tmpDir := t.TempDir()
-		testutil.CreateFile(t, tmpDir, subjectFile, subjectFile)
+		testutil.CreateFile(t, tmpDir, subjectFile, subject)
 		testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
 
-		template, err := NewTemplate(tmpDir, false)
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{MinifyHtml: true})
+		assert.NoError(t, err)
+
+		m, err := template.Render(map[string]string{"data": "test-data"})
+		assert.NoError(t, err)
+		assert.Equal(t, "test-text-body test-data", m.TextBody)
+		assert.Empty(t, m.HtmlBody)
+	})
+
+	t.Run("WithoutTextAndHtmlBodies", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, subjectFile, subject)
+
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{})
 		assert.Error(t, err)
 		assert.Nil(t, template)
 	})
@@ -52,7 +72,7 @@ func TestTemplate(t *testing.T) {
 		testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
 		testutil.CreateFile(t, tmpDir, htmlBodyFile, htmlBody)
 
-		template, err := NewTemplate(tmpDir, true)
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{MinifyHtml: true})
 		assert.NoError(t, err)
 		assert.NotNil(t, template)
 
@@ -72,7 +92,7 @@ func TestTemplate(t *testing.T) {
 		testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
 		testutil.CreateFile(t, tmpDir, htmlBodyFile, htmlBody)
 
-		template, err := NewTemplate(tmpDir, false)
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{})
 		assert.NoError(t, err)
 		assert.NotNil(t, template)
 
@@ -85,4 +105,484 @@ func TestTemplate(t *testing.T) {
 		assert.Contains(t, m.HtmlBody, tmpDir)
 		assert.Regexp(t, `\s\s+`, m.HtmlBody)
 	})
+
+	t.Run("RenderWithHtmlEscaping", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, subjectFile, subject)
+		testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+		testutil.CreateFile(t, tmpDir, htmlBodyFile, `<p>{{ .data }}</p><div>{{ .raw }}</div>`)
+
+		data := map[string]string{"data": "Tom & Jerry <script>", "raw": "<b>bold</b>"}
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{})
+		assert.NoError(t, err)
+
+		m, err := template.Render(data)
+		assert.NoError(t, err)
+		assert.Equal(t, "test-subject Tom & Jerry <script>", m.Subject)
+		assert.Equal(t, "test-text-body Tom & Jerry <script>", m.TextBody)
+		assert.Equal(t, `<p>Tom &amp; Jerry &lt;script&gt;</p><div>&lt;b&gt;bold&lt;/b&gt;</div>`, m.HtmlBody)
+
+		template, err = NewTemplate(tmpDir, &config.MessageConfig{RawHtmlColumnNames: []string{"raw"}})
+		assert.NoError(t, err)
+
+		m, err = template.Render(data)
+		assert.NoError(t, err)
+		assert.Equal(t, `<p>Tom &amp; Jerry &lt;script&gt;</p><div><b>bold</b></div>`, m.HtmlBody)
+	})
+
+	t.Run("RenderWithPartials", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		partialsDir := t.TempDir()
+		testutil.CreateFile(t, partialsDir, "layout.html", `<main>{{ block "content" . }}default{{ end }}</main>{{ template "footer" . }}`)
+		testutil.CreateFile(t, partialsDir, "footer.html", `{{ define "footer" }}<footer>{{ .data }}</footer>{{ end }}`)
+		testutil.CreateFile(t, partialsDir, "footer.txt", `{{ define "footer" }}-- {{ .data }}{{ end }}`)
+
+		testutil.CreateFile(t, tmpDir, subjectFile, subject)
+		testutil.CreateFile(t, tmpDir, textBodyFile, `test-text-body {{ template "footer" . }}`)
+		testutil.CreateFile(t, tmpDir, htmlBodyFile, `{{ template "layout.html" . }}{{ define "content" }}<p>{{ .data }}</p>{{ end }}`)
+
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{PartialsDir: partialsDir})
+		assert.NoError(t, err)
+
+		m, err := template.Render(map[string]string{"data": "<test>"})
+		assert.NoError(t, err)
+		assert.Equal(t, "test-text-body -- <test>", m.TextBody)
+		assert.Equal(t, "<main><p>&lt;test&gt;</p></main><footer>&lt;test&gt;</footer>", m.HtmlBody)
+	})
+
+	t.Run("WithMissingPartialsDir", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, subjectFile, subject)
+		testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+		testutil.CreateFile(t, tmpDir, htmlBodyFile, htmlBody)
+
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{PartialsDir: "partials"})
+		assert.Error(t, err)
+		assert.Nil(t, template)
+	})
+
+	t.Run("RenderWithMarkdown", func(t *testing.T) {
+		const markdownBody = "# Hello {{ .data }}\n\nVisit the [docs](https://iris.test/docs)."
+
+		t.Run("WithoutLayout", func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testutil.CreateFile(t, tmpDir, subjectFile, subject)
+			testutil.CreateFile(t, tmpDir, markdownBodyFile, markdownBody)
+
+			template, err := NewTemplate(tmpDir, &config.MessageConfig{})
+			assert.NoError(t, err)
+
+			m, err := template.Render(map[string]string{"data": "Tom & Jerry <script>"})
+			assert.NoError(t, err)
+			assert.Equal(t, "Hello Tom & Jerry\n\nVisit the docs (https://iris.test/docs).", m.TextBody)
+			assert.Equal(t, "<h1>Hello Tom &amp; Jerry <!-- raw HTML omitted --></h1>\n<p>Visit the <a href=\"https://iris.test/docs\">docs</a>.</p>\n", m.HtmlBody)
+		})
+
+		t.Run("WithLayout", func(t *testing.T) {
+			tmpDir := t.TempDir()
+			partialsDir := t.TempDir()
+			testutil.CreateFile(t, partialsDir, LayoutFile, `<main>{{ block "content" . }}{{ end }}</main><footer>{{ .data }}</footer>`)
+			testutil.CreateFile(t, tmpDir, subjectFile, subject)
+			testutil.CreateFile(t, tmpDir, markdownBodyFile, markdownBody)
+
+			template, err := NewTemplate(tmpDir, &config.MessageConfig{PartialsDir: partialsDir, MinifyHtml: true})
+			assert.NoError(t, err)
+
+			m, err := template.Render(map[string]string{"data": "Jack"})
+			assert.NoError(t, err)
+			assert.Equal(t, `<main><h1>Hello Jack</h1><p>Visit the <a href="https://iris.test/docs">docs</a>.</p></main><footer>Jack</footer>`, m.HtmlBody)
+		})
+
+		t.Run("WithTextAndHtmlBodies", func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testutil.CreateFile(t, tmpDir, subjectFile, subject)
+			testutil.CreateFile(t, tmpDir, markdownBodyFile, markdownBody)
+			testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+			testutil.CreateFile(t, tmpDir, htmlBodyFile, htmlBody)
+
+			template, err := NewTemplate(tmpDir, &config.MessageConfig{})
+			assert.Error(t, err)
+			assert.Nil(t, template)
+		})
+	})
+
+	t.Run("RenderWithInlineCss", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, subjectFile, subject)
+		testutil.CreateFile(t, tmpDir, htmlBodyFile, `<html><head><style>p { color: red } @media (max-width: 600px) { p { color: blue } }</style></head><body><p>{{ .data }}</p></body></html>`)
+
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{InlineCss: true, MinifyHtml: true})
+		assert.NoError(t, err)
+
+		m, err := template.Render(map[string]string{"data": "test-data"})
+		assert.NoError(t, err)
+		assert.Equal(t, "test-data", m.TextBody)
+		assert.Contains(t, m.HtmlBody, `<p style="color: red">test-data</p>`)
+		assert.Contains(t, m.HtmlBody, `<style>@media (max-width: 600px) { p { color: blue } }</style>`)
+	})
+
+	t.Run("RenderWithLocales", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, subjectFile, "hello {{ .data }}")
+		testutil.CreateFile(t, tmpDir, textBodyFile, "text")
+		testutil.CreateFile(t, tmpDir, "subject.de.txt", "hallo {{ .data }}")
+		testutil.CreateFile(t, tmpDir, "body.de.html", "<p>html</p>")
+		testutil.CreateFile(t, tmpDir, "subject.pt_BR.txt", "olá {{ .data }}")
+		testutil.CreateFile(t, tmpDir, "body.pt_BR.txt", "texto")
+
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{LocaleColumnName: "locale", DefaultLocale: "en"})
+		assert.NoError(t, err)
+
+		for _, test := range []struct {
+			locale      string
+			wantSubject string
+			wantText    string
+		}{
+			{locale: "en", wantSubject: "hello jack", wantText: "text"},
+			{locale: "", wantSubject: "hello jack", wantText: "text"},
+			{locale: "fr", wantSubject: "hello jack", wantText: "text"},
+			{locale: "de", wantSubject: "hallo jack", wantText: "html"},
+			{locale: "de-AT", wantSubject: "hallo jack", wantText: "html"},
+			{locale: "pt-br", wantSubject: "olá jack", wantText: "texto"},
+		} {
+			m, err := template.Render(map[string]string{"data": "jack", "locale": test.locale})
+			assert.NoError(t, err)
+			assert.Equal(t, test.wantSubject, m.Subject, test.locale)
+			assert.Equal(t, test.wantText, m.TextBody, test.locale)
+		}
+
+		assert.True(t, template.HasLocale("EN"))
+		assert.True(t, template.HasLocale("de_CH"))
+		assert.False(t, template.HasLocale("fr"))
+	})
+
+	t.Run("WithDefaultLocaleTemplates", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, "subject.en.txt", "hello")
+		testutil.CreateFile(t, tmpDir, "body.en.txt", "text")
+		testutil.CreateFile(t, tmpDir, "subject.de.txt", "hallo")
+		testutil.CreateFile(t, tmpDir, "body.de.txt", "text")
+
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{LocaleColumnName: "locale", DefaultLocale: "en"})
+		assert.NoError(t, err)
+
+		m, err := template.Render(map[string]string{"locale": "fr"})
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", m.Subject)
+
+		template, err = NewTemplate(tmpDir, &config.MessageConfig{LocaleColumnName: "locale"})
+		assert.Error(t, err)
+		assert.Nil(t, template)
+	})
+
+	t.Run("WithIncompleteLocale", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, subjectFile, subject)
+		testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+		testutil.CreateFile(t, tmpDir, "body.de.txt", "text")
+
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{LocaleColumnName: "locale"})
+		assert.Error(t, err)
+		assert.Nil(t, template)
+	})
+
+	t.Run("RenderWithVariants", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, subjectFile, "hello {{ .Variant }}")
+		testutil.CreateFile(t, tmpDir, textBodyFile, "text {{ .Variant }}")
+		testutil.CreateFile(t, tmpDir, "subject.B.txt", "hi {{ .Variant }}")
+		testutil.CreateFile(t, tmpDir, "body.B.txt", "text B")
+
+		cfg := &config.MessageConfig{
+			RecipientEmailColumnName: "email",
+			Variants:                 []config.VariantConfig{{Name: "A", Weight: 3}, {Name: "B", Weight: 1}},
+			VariantSeed:              "campaign",
+		}
+
+		template, err := NewTemplate(tmpDir, cfg)
+		assert.NoError(t, err)
+
+		counts := map[string]int{}
+		for i := 0; i < 1000; i++ {
+			address := fmt.Sprintf("user-%d@iris.test", i)
+			m, err := template.Render(map[string]string{"email": address})
+			assert.NoError(t, err)
+			counts[m.Variant]++
+
+			switch m.Variant {
+			case "A":
+				assert.Equal(t, "hello A", m.Subject)
+				assert.Equal(t, "text A", m.TextBody)
+			case "B":
+				assert.Equal(t, "hi B", m.Subject)
+				assert.Equal(t, "text B", m.TextBody)
+			default:
+				t.Fatalf("unexpected variant %q", m.Variant)
+			}
+
+			again, err := template.Render(map[string]string{"email": " " + strings.ToUpper(address)})
+			assert.NoError(t, err)
+			assert.Equal(t, m.Variant, again.Variant)
+		}
+
+		assert.InDelta(t, 750, counts["A"], 60)
+		assert.InDelta(t, 250, counts["B"], 60)
+	})
+
+	t.Run("WithInvalidVariants", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, subjectFile, subject)
+		testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+
+		for _, cfg := range []*config.MessageConfig{
+			{Variants: []config.VariantConfig{{Name: "", Weight: 1}}},
+			{Variants: []config.VariantConfig{{Name: "a.b", Weight: 1}}},
+			{Variants: []config.VariantConfig{{Name: "A", Weight: 0}}},
+			{Variants: []config.VariantConfig{{Name: "A", Weight: 1}, {Name: "A", Weight: 1}}},
+			{Variants: []config.VariantConfig{{Name: "A", Weight: 1}}, LocaleColumnName: "locale"},
+		} {
+			template, err := NewTemplate(tmpDir, cfg)
+			assert.Error(t, err)
+			assert.Nil(t, template)
+		}
+	})
+
+	t.Run("RenderWithInlineImages", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, subjectFile, subject)
+		testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+		testutil.CreateFile(t, tmpDir, htmlBodyFile, `<img src="{{ embed "logo.png" }}"><img src="cid:banner.png"><img src="cid:logo.png">`)
+		testutil.CreateFile(t, tmpDir, "logo.png", "test-logo")
+		testutil.CreateFile(t, tmpDir, "banner.png", "test-banner")
+
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{MinifyHtml: true})
+		assert.NoError(t, err)
+
+		m, err := template.Render(map[string]string{"data": tmpDir})
+		assert.NoError(t, err)
+		assert.Contains(t, m.HtmlBody, `src="cid:logo.png"`)
+		assert.Contains(t, m.HtmlBody, `src="cid:banner.png"`)
+		assert.Len(t, m.InlineImages, 2)
+		assert.Equal(t, "logo.png", m.InlineImages[0].Name)
+		assert.Equal(t, []byte("test-logo"), m.InlineImages[0].Data)
+		assert.Equal(t, "banner.png", m.InlineImages[1].Name)
+		assert.Equal(t, []byte("test-banner"), m.InlineImages[1].Data)
+	})
+
+	t.Run("RenderWithMissingInlineImage", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, subjectFile, subject)
+		testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+		testutil.CreateFile(t, tmpDir, htmlBodyFile, `<img src="{{ embed "logo.png" }}">`)
+
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{})
+		assert.NoError(t, err)
+
+		m, err := template.Render(map[string]string{"data": tmpDir})
+		assert.Error(t, err)
+		assert.Nil(t, m)
+	})
+
+	t.Run("RenderWithCidInRecipientData", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, subjectFile, subject)
+		testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+		testutil.CreateFile(t, tmpDir, htmlBodyFile, `<p>{{ .data }}</p><img src="cid:logo.png">`)
+		testutil.CreateFile(t, tmpDir, "logo.png", "logo")
+		testutil.CreateFile(t, tmpDir, "secret.txt", "secret")
+
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{})
+		assert.NoError(t, err)
+
+		m, err := template.Render(map[string]string{"data": "cid:secret.txt cid:../secret.txt cid:foo"})
+		assert.NoError(t, err)
+		if assert.Len(t, m.InlineImages, 1) {
+			assert.Equal(t, "logo.png", m.InlineImages[0].Name)
+		}
+	})
+
+	t.Run("RenderWithInvalidInlineImagePath", func(t *testing.T) {
+		for _, path := range []string{"../logo.png", "/etc/hosts", "images/../../logo.png"} {
+			tmpDir := t.TempDir()
+			testutil.CreateFile(t, tmpDir, subjectFile, subject)
+			testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+			testutil.CreateFile(t, tmpDir, htmlBodyFile, `<img src="{{ embed .data }}">`)
+
+			template, err := NewTemplate(tmpDir, &config.MessageConfig{})
+			assert.NoError(t, err)
+
+			m, err := template.Render(map[string]string{"data": path})
+			assert.Error(t, err, path)
+			assert.Nil(t, m, path)
+		}
+	})
+
+	t.Run("RenderWithHeaders", func(t *testing.T) {
+		tt := []struct {
+			name        string
+			cfg         *config.MessageConfig
+			data        string
+			wantHeaders map[string]string
+			wantErr     bool
+		}{
+			{
+				name: "WithTemplatedHeaders",
+				cfg: &config.MessageConfig{
+					Headers: map[string]string{
+						"x-campaign":  "test-campaign",
+						"X-Recipient": "{{ .data }}",
+					},
+				},
+				data: "test-data",
+				wantHeaders: map[string]string{
+					"X-Campaign":  "test-campaign",
+					"X-Recipient": "test-data",
+				},
+			},
+			{
+				name: "WithListUnsubscribe",
+				cfg: &config.MessageConfig{
+					ListUnsubscribe:         "<https://iris.test/unsubscribe?u={{ .data }}>",
+					ListUnsubscribeOneClick: true,
+				},
+				data: "test-data",
+				wantHeaders: map[string]string{
+					"List-Unsubscribe":      "<https://iris.test/unsubscribe?u=test-data>",
+					"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+				},
+			},
+			{
+				name: "WithOneClickUnsubscribeWithoutHttpsUrl",
+				cfg: &config.MessageConfig{
+					ListUnsubscribe:         "<mailto:{{ .data }}>",
+					ListUnsubscribeOneClick: true,
+				},
+				data:    "test-data",
+				wantErr: true,
+			},
+			{
+				name: "WithLineBreakInHeader",
+				cfg: &config.MessageConfig{
+					Headers: map[string]string{"X-Recipient": "{{ .data }}"},
+				},
+				data:    "test-data\r\nBcc: test@iris.test",
+				wantErr: true,
+			},
+		}
+
+		for _, test := range tt {
+			t.Run(test.name, func(t *testing.T) {
+				tmpDir := t.TempDir()
+				testutil.CreateFile(t, tmpDir, subjectFile, subject)
+				testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+				testutil.CreateFile(t, tmpDir, htmlBodyFile, htmlBody)
+
+				template, err := NewTemplate(tmpDir, test.cfg)
+				assert.NoError(t, err)
+
+				m, err := template.Render(map[string]string{"data": test.data})
+				if test.wantErr {
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+					assert.Equal(t, test.wantHeaders, m.Headers)
+				}
+			})
+		}
+	})
+
+	t.Run("WithInvalidHeaders", func(t *testing.T) {
+		for _, cfg := range []*config.MessageConfig{
+			{Headers: map[string]string{"from": "test@iris.test"}},
+			{Headers: map[string]string{"X-Test": "{{ .data "}},
+			{ListUnsubscribeOneClick: true},
+		} {
+			tmpDir := t.TempDir()
+			testutil.CreateFile(t, tmpDir, subjectFile, subject)
+			testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+			testutil.CreateFile(t, tmpDir, htmlBodyFile, htmlBody)
+
+			template, err := NewTemplate(tmpDir, cfg)
+			assert.Error(t, err)
+			assert.Nil(t, template)
+		}
+	})
+
+	t.Run("RenderWithMissingKeyPolicy", func(t *testing.T) {
+		const textBody = "test-text-body {{ .nmae }}"
+		for _, test := range []struct {
+			policy       string
+			wantTextBody string
+			wantErr      bool
+		}{
+			{policy: "", wantTextBody: "test-text-body <no value>"},
+			{policy: "default", wantTextBody: "test-text-body <no value>"},
+			{policy: "zero", wantTextBody: "test-text-body "},
+			{policy: "error", wantErr: true},
+		} {
+			t.Run(test.policy, func(t *testing.T) {
+				tmpDir := t.TempDir()
+				testutil.CreateFile(t, tmpDir, subjectFile, subject)
+				testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+				testutil.CreateFile(t, tmpDir, htmlBodyFile, htmlBody)
+
+				template, err := NewTemplate(tmpDir, &config.MessageConfig{MissingKeyPolicy: test.policy})
+				assert.NoError(t, err)
+
+				m, err := template.Render(map[string]string{"data": "test-data"})
+				if test.wantErr {
+					var missingKeyErr *MissingKeyError
+					assert.ErrorAs(t, err, &missingKeyErr)
+					assert.Equal(t, textBodyFile, missingKeyErr.File)
+					assert.Equal(t, "nmae", missingKeyErr.Key)
+				} else {
+					assert.NoError(t, err)
+					assert.Equal(t, test.wantTextBody, m.TextBody)
+				}
+			})
+		}
+	})
+
+	t.Run("RenderWithMissingKeyPolicyAndStructuredData", func(t *testing.T) {
+		const textBody = "{{ .nmae }}-{{ .nil }}-{{ range .items }}{{ .name }}{{ .price }};{{ end }}-{{ if .nmae }}x{{ end }}"
+		for _, test := range []struct {
+			policy       string
+			wantSubject  string
+			wantTextBody string
+			wantHtmlBody string
+		}{
+			{policy: "default", wantSubject: "test-subject-", wantTextBody: "<no value>--a<no value>;2;-", wantHtmlBody: "<p>-</p>"},
+			{policy: "zero", wantSubject: "test-subject-", wantTextBody: "--a;2;-", wantHtmlBody: "<p>-</p>"},
+		} {
+			t.Run(test.policy, func(t *testing.T) {
+				tmpDir := t.TempDir()
+				testutil.CreateFile(t, tmpDir, subjectFile, "test-subject-{{ .nil }}")
+				testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+				testutil.CreateFile(t, tmpDir, htmlBodyFile, "<p>{{ .nmae }}-{{ .nil }}</p>")
+
+				template, err := NewTemplate(tmpDir, &config.MessageConfig{MissingKeyPolicy: test.policy})
+				assert.NoError(t, err)
+
+				m, err := template.Render(map[string]any{
+					"nil":   nil,
+					"items": []any{map[string]any{"name": "a"}, map[string]any{"name": nil, "price": int64(2)}},
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, test.wantSubject, m.Subject)
+				assert.Equal(t, test.wantTextBody, m.TextBody)
+				assert.Equal(t, test.wantHtmlBody, m.HtmlBody)
+			})
+		}
+	})
+
+	t.Run("WithInvalidMissingKeyPolicy", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testutil.CreateFile(t, tmpDir, subjectFile, subject)
+		testutil.CreateFile(t, tmpDir, textBodyFile, textBody)
+		testutil.CreateFile(t, tmpDir, htmlBodyFile, htmlBody)
+
+		template, err := NewTemplate(tmpDir, &config.MessageConfig{MissingKeyPolicy: "ignore"})
+		assert.Error(t, err)
+		assert.Nil(t, template)
+	})
 }
@@ -26,6 +26,8 @@ func main() {
 
 	rootCmd.AddCommand(cmd.InitCommand(v, configName+"."+configType))
 	rootCmd.AddCommand(cmd.SendCommand(v))
+	rootCmd.AddCommand(cmd.ValidateCommand(v))
+	rootCmd.AddCommand(cmd.SuppressCommand())
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)